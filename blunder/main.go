@@ -3,12 +3,23 @@ package main
 import (
 	"blunder/core"
 	inter "blunder/interface"
+	"blunder/tuner"
+	"flag"
 	"fmt"
 )
 
 var DEBUG bool = false
 
 func main() {
+	cli := flag.Bool("cli", false, "play against Blunder from the command line instead of using the UCI protocol")
+	fen := flag.String("fen", "", "the starting position when playing from the command line, as a FEN string or \"startpos\"")
+	color := flag.String("color", "", "the color to play as when playing from the command line (white or black)")
+	bench := flag.Bool("bench", false, "search a fixed set of positions and report the number of nodes searched and the nodes per second")
+	benchDepth := flag.Int("depth", core.BenchDepth, "the depth to search each position to when running the bench")
+	tune := flag.String("tune", "", "tune the evaluation on a file of quiet positions, each a FEN string followed by the result of its game, and print the tuned parameters")
+	tuneIterations := flag.Int("iterations", tuner.DefaultIterations, "the maximum number of iterations to tune the evaluation for")
+	flag.Parse()
+
 	if DEBUG {
 		var searcher core.Searcher
 		searcher.Init()
@@ -19,6 +30,14 @@ func main() {
 		fmt.Println("Best move:", core.MoveToStr(bestMove))
 		fmt.Println("Nodes explored:", searcher.NodesExplored)
 		fmt.Println("Transposition table hits:", searcher.TTHits)*/
+	} else if *tune != "" {
+		if err := tuner.Run(*tune, *tuneIterations); err != nil {
+			fmt.Println(err)
+		}
+	} else if *bench {
+		core.Bench(*benchDepth)
+	} else if *cli {
+		inter.RunCommandLineProtocol(*fen, *color)
 	} else {
 		inter.RunUCIProtocol()
 	}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// This file contains the bench command, which searches a fixed set of
+// positions to a fixed depth and reports how many nodes were searched, and
+// how fast. Since the positions, the depth, and the size of the
+// transposition table are always the same, and only one thread is used, the
+// total node count is the same every time for a given version of the
+// engine, so it can be used as a signature to catch changes to the search
+// that weren't meant to change its behavior, while the nodes per second
+// can be used to compare the speed of different versions.
+
+const (
+	// The depth each position is searched to, if no other depth is given.
+	BenchDepth = 8
+
+	// The size of the transposition table used by the bench, in
+	// megabytes, which is kept the same whatever the hash size set by
+	// the GUI is, so the node count doesn't depend on it.
+	BenchTTSizeMB = 16
+)
+
+// The positions searched by the bench, which are a mix of openings,
+// middlegames, and endgames.
+var BenchPositions = []string{
+	FENStartPosition,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 10",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 11",
+	"4rrk1/pp1n3p/3q2pQ/2p1pb2/2PP4/2P3N1/P2B2PP/4RRK1 b - - 7 19",
+	"rq3rk1/ppp2ppp/1bnpb3/3N2B1/3NP3/7P/PPPQ1PP1/2KR3R w - - 7 14",
+	"r1bq1r1k/1pp1n1pp/1p1p4/4p2Q/4Pp2/1BNP4/PPP2PPP/3R1RK1 w - - 2 14",
+	"r3r1k1/2p2ppp/p1p1bn2/8/1q2P3/2NPQN2/PPP3PP/R4RK1 b - - 2 15",
+	"r1bbk1nr/pp3p1p/2n5/1N4p1/2Np1B2/8/PPP2PPP/2KR1B1R w kq - 0 13",
+	"r1bq1rk1/ppp1nppp/4n3/3p3Q/3P4/1BP1B3/PP1N2PP/R4RK1 w - - 1 16",
+	"4r1k1/r1q2ppp/ppp2n2/4P3/5Rb1/1N1BQ3/PPP3PP/R5K1 w - - 1 17",
+	"2rqkb1r/ppp2p2/2npb1p1/1N1Nn2p/2P1PP2/8/PP2B1PP/R1BQK2R b KQ - 0 11",
+	"r1bq1r1k/b1p1npp1/p2p3p/1p6/3PP3/1B2NN2/PP3PPP/R2Q1RK1 w - - 1 16",
+	"3r1rk1/p5pp/bpp1pp2/8/q1PP1P2/b3P3/P2NQRPP/1R2B1K1 b - - 6 22",
+	"r1q2rk1/2p1bppp/2Pp4/p6b/Q1PNp3/4B3/PP1R1PPP/2K4R w - - 2 18",
+	"4k2r/1pb2ppp/1p2p3/1R1p4/3P4/2r1PN2/P4PPP/1R4K1 b - - 3 22",
+	"3q2k1/pb3p1p/4pbp1/2r5/PpN2N2/1P2P2P/5PP1/Q2R2K1 b - - 4 26",
+	"6k1/6p1/6Pp/ppp5/3pn2P/1P3K2/1PP2P2/8 b - - 0 1",
+	"8/8/8/8/5kp1/P7/8/1K1N4 w - - 0 1",
+	"8/8/1P6/5pr1/8/4R3/7k/2K5 w - - 0 1",
+	"8/R7/2q5/8/6k1/8/1P5p/K6R w - - 0 124",
+}
+
+// Search each of the bench positions to the given depth, printing the
+// number of nodes searched in each one, and then the total number of
+// nodes, the time taken, and the nodes per second. The total number of
+// nodes is returned. A new searcher is used, and reset before each
+// position, so nothing set by the GUI or found by an earlier search can
+// change the results.
+func Bench(depth int) uint64 {
+	var searcher Searcher
+	searcher.ResizeTT(BenchTTSizeMB)
+
+	var totalNodes, ttProbes, ttHits uint64
+	start := time.Now()
+	for index, fen := range BenchPositions {
+		searcher.Init()
+		if err := searcher.LoadFEN(fen); err != nil {
+			panic(err)
+		}
+		bestMove, _, _ := searcher.SearchQuietly(SearchLimits{Depth: depth})
+		nodes := searcher.TotalNodesExplored()
+		totalNodes += nodes
+		ttProbes += searcher.TTProbes
+		ttHits += searcher.TTHits
+		fmt.Printf("position %d: %v nodes (bestmove %v)\n", index+1, nodes, ConvertMoveToLongAlgebraicNotation(bestMove))
+	}
+
+	elapsed := time.Since(start)
+	nps := uint64(float64(totalNodes) / elapsed.Seconds())
+	fmt.Printf("\ntotal nodes: %v\ntime: %vms\nnps: %v\n", totalNodes, int64(elapsed/time.Millisecond), nps)
+	fmt.Printf("tt hits: %v of %v probes (%.1f%%)\n", ttHits, ttProbes, 100*float64(ttHits)/float64(max(int(ttProbes), 1)))
+	return totalNodes
+}
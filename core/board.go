@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"math/bits"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -44,6 +45,12 @@ const (
 	BlackKingside  uint8 = 0x20
 	BlackQueenside uint8 = 0x10
 
+	// Indexes into CastlingRookSqs for each castling right
+	WhiteKingsideRook  = 0
+	WhiteQueensideRook = 1
+	BlackKingsideRook  = 2
+	BlackQueensideRook = 3
+
 	// Constant representing no en passant square
 	NoEPSquare = -1
 
@@ -55,9 +62,28 @@ const (
 	// as a good test for the move generator.
 	FENKiwiPete = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
 
-	// A constant representing how many pieces are left before the engine
-	// switches into an endgame mode.
-	EndgameThreshold = 12
+	// The number of half-moves without a capture or a pawn move after
+	// which the game is drawn by the fifty-move rule.
+	FiftyMoveRuleLimit = 100
+
+	// The game phase at or below which the engine switches into an
+	// endgame mode. This is roughly a rook and a minor piece each.
+	EndgameThreshold = 64
+
+	// The weight each non-pawn piece contributes to the game phase, and
+	// the total phase of the starting position. The phase is scaled from
+	// this total to a value between 0 (bare kings and pawns) and MaxPhase
+	// (all of the non-pawn material still on the board).
+	KnightPhase = 1
+	BishopPhase = 1
+	RookPhase   = 2
+	QueenPhase  = 4
+	TotalPhase  = KnightPhase*4 + BishopPhase*4 + RookPhase*4 + QueenPhase*2
+	MaxPhase    = 256
+
+	// The initial capacity of the undo stack. The stack will grow past
+	// this if needed, but most games and searches will fit in it.
+	UndoStackSize = 256
 )
 
 // A structure for holding data concering the current position
@@ -70,6 +96,11 @@ type UndoInfo struct {
 	FullMoveCounter int
 	CaptureSq       uint8
 	FromSq          uint8
+
+	// The Zobrist hash of the position before the move was made, which
+	// is kept so positions repeated from earlier in the game can be
+	// found (see IsRepetition).
+	Hash uint64
 }
 
 // The primary internal representation of the board
@@ -77,6 +108,16 @@ type Board struct {
 	// List of bitboards for each type of piece and color
 	PieceBB [8]uint64
 
+	// A bitboard of every occupied square, which is the union of
+	// the two color bitboards. It's kept up to date as pieces are put,
+	// removed, and moved, since move generation needs it constantly.
+	Occupied uint64
+
+	// The squares the kings are on, indexed by color, like the scores
+	// below. They're kept up to date as kings are put and moved, since
+	// finding a king on its bitboard is needed constantly.
+	KingSq [8]int
+
 	// Mailbox representation of the board. Using a hybrid approach
 	// of bitboards and mailbox representations allow for cleaner,
 	// and more efficent code. The bitboard internal representation
@@ -113,23 +154,57 @@ type Board struct {
 	// Castling Black Queenside  = 4th bit
 	CastlingRights uint8
 
+	// The starting squares of the rooks used for each castling
+	// right, indexed in the same order as the rights above (see
+	// the CastlingRook constants). In standard chess these are
+	// always the corner squares, but in Chess960 they depend on
+	// the starting position, and are given by the FEN string.
+	CastlingRookSqs [4]int
+
+	// Whether the game being played is Chess960, in which case castling
+	// moves are generated for rooks and kings starting anywhere on the back
+	// rank. This is set by the GUI, and isn't changed by loading a FEN.
+	Chess960 bool
+
+	// The material and piece square table scores of each side, in the
+	// middle game and endgame, indexed by phase (MG or EG) and then by
+	// color. These are updated incrementally as pieces are put, removed,
+	// and moved, so the evaluation doesn't have to recompute them.
+	MaterialScores [2][8]int
+	PositionScores [2][8]int
+
 	// The Zobrist hashing representing the current
 	// board state. This is initalized from a loaded
 	// fen string and updated incrementally as moves
 	// are made and unmade from the board.
 	Hash uint64
 
-	// An array that holds UndoInfo structures (see above)
+	// A stack that holds UndoInfo structures (see above)
 	// concering positions at different game plys. The current
-	// ply is kept track of by gamePly
-	undoInfoList [200]UndoInfo
+	// ply is kept track of by gamePly. The stack grows as needed,
+	// so long games and deep analysis lines can't overflow it.
+	undoInfoList []UndoInfo
 	gamePly      int
 }
 
-// Push an undoInfo object to the stack
+// Make a copy of the board that can be played on without changing
+// this one, since the copy needs its own stack of UndoInfo structures.
+func (board *Board) Copy() Board {
+	copied := *board
+	copied.undoInfoList = make([]UndoInfo, len(board.undoInfoList))
+	copy(copied.undoInfoList, board.undoInfoList)
+	return copied
+}
+
+// Push an undoInfo object to the stack, growing the stack if
+// it's full.
 func (board *Board) saveState(undoInfo UndoInfo) {
 	board.gamePly++
-	board.undoInfoList[board.gamePly] = undoInfo
+	if board.gamePly == len(board.undoInfoList) {
+		board.undoInfoList = append(board.undoInfoList, undoInfo)
+	} else {
+		board.undoInfoList[board.gamePly] = undoInfo
+	}
 }
 
 // Pop an undoInfo object from the stack
@@ -157,6 +232,7 @@ func (board *Board) DoMove(move *uint16, saveState bool) {
 		FullMoveCounter: board.FullMoveCounter,
 		CaptureSq:       board.Pieces[to],
 		FromSq:          board.Pieces[from],
+		Hash:            board.Hash,
 	}
 
 	// Remove the current en passant square if any
@@ -166,18 +242,15 @@ func (board *Board) DoMove(move *uint16, saveState bool) {
 	board.EPSquare = NoEPSquare
 
 	switch moveType {
-	case CastleWKS:
-		board.movePiece(E1, G1)
-		board.movePiece(H1, F1)
-	case CastleWQS:
-		board.movePiece(E1, C1)
-		board.movePiece(A1, D1)
-	case CastleBKS:
-		board.movePiece(E8, G8)
-		board.movePiece(H8, F8)
-	case CastleBQS:
-		board.movePiece(E8, C8)
-		board.movePiece(A8, D8)
+	case CastleWKS, CastleWQS, CastleBKS, CastleBQS:
+		// In Chess960, the king or rook can already be on the other
+		// one's destination, so both are lifted off before either is
+		// put back down.
+		right := int(moveType - CastleWKS)
+		board.removePiece(from)
+		board.removePiece(board.CastlingRookSqs[right])
+		board.putPiece(KingBB, usColor, CastlingKingDestSqs[right])
+		board.putPiece(RookBB, usColor, CastlingRookDestSqs[right])
 	case KnightPromotion:
 		board.removePiece(from)
 		if undoInfo.CaptureSq != NoPiece {
@@ -247,26 +320,20 @@ func (board *Board) DoMove(move *uint16, saveState bool) {
 		}
 	}
 
-	// Update the castling rights
-	if GetPieceType(board.Pieces[E1]) != KingBB {
-		board.CastlingRights &= ^WhiteKingside
-		board.CastlingRights &= ^WhiteQueenside
-	}
-	if GetPieceType(board.Pieces[H1]) != RookBB {
-		board.CastlingRights &= ^WhiteKingside
-	}
-	if GetPieceType(board.Pieces[A1]) != RookBB {
-		board.CastlingRights &= ^WhiteQueenside
-	}
-	if GetPieceType(board.Pieces[E8]) != KingBB {
-		board.CastlingRights &= ^BlackKingside
-		board.CastlingRights &= ^BlackQueenside
-	}
-	if GetPieceType(board.Pieces[H8]) != RookBB {
-		board.CastlingRights &= ^BlackKingside
+	// Update the castling rights. Both of a side's rights are lost once
+	// its king moves, and the right to castle with a rook is lost once the
+	// rook moves or is captured.
+	if GetPieceType(undoInfo.FromSq) == KingBB {
+		if usColor == WhiteBB {
+			board.CastlingRights &= ^(WhiteKingside | WhiteQueenside)
+		} else {
+			board.CastlingRights &= ^(BlackKingside | BlackQueenside)
+		}
 	}
-	if GetPieceType(board.Pieces[A8]) != RookBB {
-		board.CastlingRights &= ^BlackQueenside
+	for right, rookSq := range board.CastlingRookSqs {
+		if from == rookSq || to == rookSq {
+			board.CastlingRights &= ^(WhiteKingside >> right)
+		}
 	}
 
 	// Only update the hash castling rights if they were
@@ -302,6 +369,10 @@ func (board *Board) DoMove(move *uint16, saveState bool) {
 	if saveState {
 		board.saveState(undoInfo)
 	}
+
+	if DebugMode {
+		debugVerify(board, *move, "making")
+	}
 }
 
 // Undo a move to the interal boards
@@ -348,18 +419,12 @@ func (board *Board) UndoMove(move *uint16) {
 	board.EPSquare = undoInfo.EPSquare
 
 	switch moveType {
-	case CastleWKS:
-		board.movePiece(G1, E1)
-		board.movePiece(F1, H1)
-	case CastleWQS:
-		board.movePiece(C1, E1)
-		board.movePiece(D1, A1)
-	case CastleBKS:
-		board.movePiece(G8, E8)
-		board.movePiece(F8, H8)
-	case CastleBQS:
-		board.movePiece(C8, E8)
-		board.movePiece(D8, A8)
+	case CastleWKS, CastleWQS, CastleBKS, CastleBQS:
+		right := int(moveType - CastleWKS)
+		board.removePiece(CastlingKingDestSqs[right])
+		board.removePiece(CastlingRookDestSqs[right])
+		board.putPiece(KingBB, usColor, from)
+		board.putPiece(RookBB, usColor, board.CastlingRookSqs[right])
 	case KnightPromotion:
 		fallthrough
 	case BishopPromotion:
@@ -369,7 +434,7 @@ func (board *Board) UndoMove(move *uint16) {
 	case QueenPromotion:
 		board.removePiece(to)
 		if undoInfo.CaptureSq != NoPiece {
-			board.putPiece(GetPieceType(undoInfo.CaptureSq), getPieceColor(undoInfo.CaptureSq), to)
+			board.putPiece(GetPieceType(undoInfo.CaptureSq), PieceColor(undoInfo.CaptureSq), to)
 		}
 		board.putPiece(PawnBB, usColor, from)
 	case AttackEP:
@@ -378,26 +443,84 @@ func (board *Board) UndoMove(move *uint16) {
 			capturePos = to - 8
 		}
 		board.movePiece(to, from)
-		board.putPiece(PawnBB, getPieceColor(undoInfo.CaptureSq), capturePos)
+		board.putPiece(PawnBB, PieceColor(undoInfo.CaptureSq), capturePos)
 	case Attack:
 		board.removePiece(to)
-		board.putPiece(GetPieceType(undoInfo.CaptureSq), getPieceColor(undoInfo.CaptureSq), to)
+		board.putPiece(GetPieceType(undoInfo.CaptureSq), PieceColor(undoInfo.CaptureSq), to)
 		board.putPiece(GetPieceType(undoInfo.FromSq), usColor, from)
 	case Quiet:
 		board.movePiece(to, from)
 	}
 
-	// Add back the old en passant square if any
+	// Add back the old en passant square if any, now that the pieces
+	// are back where they were when it was set.
 	if undoInfo.EPSquare != NoEPSquare && isValidZobristEPSq(board, undoInfo.EPSquare) {
+		board.Hash ^= getEPFileHash(undoInfo.EPSquare)
+	}
+
+	if DebugMode {
+		debugVerify(board, *move, "unmaking")
+	}
+}
+
+// Pass the turn to the other side without moving a piece, which is
+// useful in the search. Any en passant square is cleared, since the
+// capture is no longer possible once the turn has passed.
+func (board *Board) MakeNullMove() {
+	board.saveState(UndoInfo{
+		CastlingRights:  board.CastlingRights,
+		EPSquare:        board.EPSquare,
+		HalfMoveClock:   board.HalfMoveClock,
+		HalfMoveCounter: board.HalfMoveCounter,
+		FullMoveCounter: board.FullMoveCounter,
+		CaptureSq:       NoPiece,
+		FromSq:          NoPiece,
+		Hash:            board.Hash,
+	})
+
+	if board.EPSquare != NoEPSquare && isValidZobristEPSq(board, board.EPSquare) {
+		board.Hash ^= getEPFileHash(board.EPSquare)
+	}
+	board.EPSquare = NoEPSquare
+
+	board.HalfMoveClock++
+	board.HalfMoveCounter++
+	if board.HalfMoveCounter%2 == 0 {
+		board.FullMoveCounter++
+	}
+
+	board.WhiteToMove = !board.WhiteToMove
+	board.Hash ^= Random64[SideToMove]
+
+	if DebugMode {
+		debugVerify(board, NullMove, "making")
+	}
+}
+
+// Undo a null move made by MakeNullMove.
+func (board *Board) UndoNullMove() {
+	undoInfo := board.popState()
+	board.HalfMoveClock = undoInfo.HalfMoveClock
+	board.HalfMoveCounter = undoInfo.HalfMoveCounter
+	board.FullMoveCounter = undoInfo.FullMoveCounter
+	board.WhiteToMove = !board.WhiteToMove
+	board.Hash ^= Random64[SideToMove]
+
+	board.EPSquare = undoInfo.EPSquare
+	if board.EPSquare != NoEPSquare && isValidZobristEPSq(board, board.EPSquare) {
 		board.Hash ^= getEPFileHash(board.EPSquare)
 	}
+
+	if DebugMode {
+		debugVerify(board, NullMove, "unmaking")
+	}
 }
 
 // Put a piece from the given square to the given square.
 // For this function, the move is gureenteed to be quiet.
 func (board *Board) movePiece(from, to int) {
 	piece := board.Pieces[from]
-	pieceType, pieceColor := GetPieceType(piece), getPieceColor(piece)
+	pieceType, pieceColor := GetPieceType(piece), PieceColor(piece)
 
 	clearBit(&board.PieceBB[pieceType], from)
 	clearBit(&board.PieceBB[pieceColor], from)
@@ -407,6 +530,16 @@ func (board *Board) movePiece(from, to int) {
 	setBit(&board.PieceBB[pieceColor], to)
 	board.Hash ^= getPieceHash(piece, to)
 
+	clearBit(&board.Occupied, from)
+	setBit(&board.Occupied, to)
+	if pieceType == KingBB {
+		board.KingSq[pieceColor] = to
+	}
+
+	fromIndex, toIndex := pstIndex(from, pieceColor), pstIndex(to, pieceColor)
+	board.PositionScores[MG][pieceColor] += EvalParameters.PieceSquareTables[MG][pieceType][toIndex] - EvalParameters.PieceSquareTables[MG][pieceType][fromIndex]
+	board.PositionScores[EG][pieceColor] += EvalParameters.PieceSquareTables[EG][pieceType][toIndex] - EvalParameters.PieceSquareTables[EG][pieceType][fromIndex]
+
 	board.Pieces[from] = NoPiece
 	board.Pieces[to] = uint8((pieceType << 5) | (pieceColor << 2))
 }
@@ -415,43 +548,96 @@ func (board *Board) movePiece(from, to int) {
 func (board *Board) putPiece(pieceType, pieceColor int, to int) {
 	setBit(&board.PieceBB[pieceType], to)
 	setBit(&board.PieceBB[pieceColor], to)
+	setBit(&board.Occupied, to)
+	if pieceType == KingBB {
+		board.KingSq[pieceColor] = to
+	}
 	board.Pieces[to] = uint8((pieceType << 5) | (pieceColor << 2))
 	board.Hash ^= getPieceHash(board.Pieces[to], to)
+	board.updateEvalScores(pieceType, pieceColor, to, 1)
 }
 
 // Remove the piece given on the given square.
 func (board *Board) removePiece(from int) {
 	piece := board.Pieces[from]
-	pieceType, pieceColor := GetPieceType(piece), getPieceColor(piece)
+	pieceType, pieceColor := GetPieceType(piece), PieceColor(piece)
 	clearBit(&board.PieceBB[pieceType], from)
 	clearBit(&board.PieceBB[pieceColor], from)
+	clearBit(&board.Occupied, from)
 	board.Hash ^= getPieceHash(piece, from)
 	board.Pieces[from] = NoPiece
+	board.updateEvalScores(pieceType, pieceColor, from, -1)
 }
 
-func (board *Board) LoadFEN(fen string) {
+// Add the material and piece square table scores of a piece on the
+// given square to its side's scores, or subtract them if sign is -1.
+func (board *Board) updateEvalScores(pieceType, pieceColor, sq, sign int) {
+	if pieceType != KingBB {
+		board.MaterialScores[MG][pieceColor] += EvalParameters.MaterialValues[MG][pieceType] * sign
+		board.MaterialScores[EG][pieceColor] += EvalParameters.MaterialValues[EG][pieceType] * sign
+	}
+	index := pstIndex(sq, pieceColor)
+	board.PositionScores[MG][pieceColor] += EvalParameters.PieceSquareTables[MG][pieceType][index] * sign
+	board.PositionScores[EG][pieceColor] += EvalParameters.PieceSquareTables[EG][pieceType][index] * sign
+}
+
+// Compute the material and piece square table scores of both sides
+// from scratch.
+func (board *Board) computeEvalScores() (materialScores, positionScores [2][8]int) {
+	for sq, piece := range board.Pieces {
+		if piece == NoPiece {
+			continue
+		}
+		pieceType, pieceColor := GetPieceType(piece), PieceColor(piece)
+		index := pstIndex(sq, pieceColor)
+		for _, phase := range []int{MG, EG} {
+			if pieceType != KingBB {
+				materialScores[phase][pieceColor] += EvalParameters.MaterialValues[phase][pieceType]
+			}
+			positionScores[phase][pieceColor] += EvalParameters.PieceSquareTables[phase][pieceType][index]
+		}
+	}
+	return materialScores, positionScores
+}
+
+// Recompute the material and piece square table scores of both sides from
+// scratch. The board keeps these up to date as moves are made, but they
+// have to be recomputed if the evaluation parameters they're computed from
+// change, such as when tuning.
+func (board *Board) RefreshEvalScores() {
+	board.MaterialScores, board.PositionScores = board.computeEvalScores()
+}
+
+// Load a FEN string into the board. If the FEN string is malformed, an
+// error describing the problem is returned, and the board is left as it
+// was. The half-move clock and full-move counter can be left off, in which
+// case they default to 0 and 1.
+func (board *Board) LoadFEN(fen string) error {
+	if err := validateFEN(fen); err != nil {
+		return err
+	}
+
 	board.PieceBB = [8]uint64{}
 	board.Pieces = [64]uint8{}
 	board.WhiteToMove = true
 	board.CastlingRights = 0
 	board.EPSquare = NoEPSquare
-	board.undoInfoList = [200]UndoInfo{}
+	board.undoInfoList = make([]UndoInfo, 0, UndoStackSize)
 	board.gamePly = -1
 
 	fenFields := strings.Fields(fen)
-	if len(fenFields) > 6 {
-		panic("Invalid FEN position")
-	}
-
 	pieces := fenFields[0]
 	turn := fenFields[1]
 	castling := fenFields[2]
 	epSq := fenFields[3]
-	halfMove := fenFields[4]
-	fullMove := fenFields[5]
 
-	board.HalfMoveClock = int(halfMove[0] - '0')
-	board.FullMoveCounter = int(fullMove[0] - '0')
+	board.HalfMoveClock, board.FullMoveCounter = 0, 1
+	if len(fenFields) > 4 {
+		board.HalfMoveClock, _ = strconv.Atoi(fenFields[4])
+	}
+	if len(fenFields) > 5 {
+		board.FullMoveCounter, _ = strconv.Atoi(fenFields[5])
+	}
 
 	for index, square := 0, 56; index < len(pieces); index++ {
 		char := pieces[index]
@@ -522,48 +708,340 @@ func (board *Board) LoadFEN(fen string) {
 			square += charToDigit(char)
 		}
 	}
+	board.Occupied = board.PieceBB[WhiteBB] | board.PieceBB[BlackBB]
+	board.KingSq[WhiteBB] = getLSBPos(board.PieceBB[KingBB] & board.PieceBB[WhiteBB])
+	board.KingSq[BlackBB] = getLSBPos(board.PieceBB[KingBB] & board.PieceBB[BlackBB])
 
+	// The half move counter is odd when it's black to move, so the full
+	// move counter is incremented after black's move.
+	board.HalfMoveCounter = 0
 	if turn == "b" {
 		board.WhiteToMove = false
+		board.HalfMoveCounter = 1
 	}
 
 	if epSq != "-" {
 		board.EPSquare = CoordinateToPos(epSq)
 	}
 
+	board.CastlingRookSqs = [4]int{H1, A1, H8, A8}
 	if castling != "-" {
-		if strings.Contains(castling, "K") {
-			board.CastlingRights |= WhiteKingside
+		for index := 0; index < len(castling); index++ {
+			board.parseCastlingRight(castling[index])
+		}
+	}
+	board.Hash = initZobristHash(board)
+	board.RefreshEvalScores()
+	return nil
+}
+
+// Check that a FEN string is well formed, and that each side has exactly
+// one king, since the move generator relies on it. An error describing
+// the first problem found is returned if it's not.
+func validateFEN(fen string) error {
+	fenFields := strings.Fields(fen)
+	if len(fenFields) < 4 || len(fenFields) > 6 {
+		return fmt.Errorf("invalid fen \"%v\": expected 4 to 6 fields, but got %d", fen, len(fenFields))
+	}
+
+	ranks := strings.Split(fenFields[0], "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("invalid fen \"%v\": expected 8 ranks, but got %d", fen, len(ranks))
+	}
+
+	kings := map[rune]int{}
+	for rankIndex, rank := range ranks {
+		squares := 0
+		for _, char := range rank {
+			switch {
+			case char >= '1' && char <= '8':
+				squares += int(char - '0')
+			case strings.ContainsRune("pnbrqkPNBRQK", char):
+				squares++
+				kings[char]++
+			default:
+				return fmt.Errorf("invalid fen \"%v\": unknown piece '%c'", fen, char)
+			}
 		}
-		if strings.Contains(castling, "Q") {
-			board.CastlingRights |= WhiteQueenside
+		if squares != 8 {
+			return fmt.Errorf("invalid fen \"%v\": rank %d has %d squares", fen, 8-rankIndex, squares)
 		}
-		if strings.Contains(castling, "k") {
-			board.CastlingRights |= BlackKingside
+	}
+	if kings['K'] != 1 || kings['k'] != 1 {
+		return fmt.Errorf("invalid fen \"%v\": each side must have exactly one king", fen)
+	}
+
+	if turn := fenFields[1]; turn != "w" && turn != "b" {
+		return fmt.Errorf("invalid fen \"%v\": unknown side to move \"%v\"", fen, turn)
+	}
+
+	if castling := fenFields[2]; castling != "-" {
+		for _, char := range castling {
+			if !strings.ContainsRune("KQkqABCDEFGHabcdefgh", char) {
+				return fmt.Errorf("invalid fen \"%v\": unknown castling right '%c'", fen, char)
+			}
 		}
-		if strings.Contains(castling, "q") {
-			board.CastlingRights |= BlackQueenside
+	}
+
+	if epSq := fenFields[3]; epSq != "-" {
+		if len(epSq) != 2 || epSq[0] < 'a' || epSq[0] > 'h' || (epSq[1] != '3' && epSq[1] != '6') {
+			return fmt.Errorf("invalid fen \"%v\": invalid en passant square \"%v\"", fen, epSq)
 		}
 	}
-	board.Hash = initZobristHash(board)
+
+	for _, clock := range fenFields[4:] {
+		if value, err := strconv.Atoi(clock); err != nil || value < 0 {
+			return fmt.Errorf("invalid fen \"%v\": invalid move clock \"%v\"", fen, clock)
+		}
+	}
+	return nil
+}
+
+// Parse a single character of a FEN string's castling field, and set
+// the castling right and rook square it gives. Three notations are
+// understood: the classic "KQkq", Shredder-FEN, which gives the file of
+// each castling rook (e.g. "HAha"), and X-FEN, which mixes the two and only
+// uses a file letter when "K" or "Q" would be ambiguous. "K" and "Q" always
+// refer to the outermost rook on that side of the king.
+func (board *Board) parseCastlingRight(char byte) {
+	color, backRank := WhiteBB, Rank1
+	if char >= 'a' && char <= 'z' {
+		color, backRank = BlackBB, Rank8
+		char -= 'a' - 'A'
+	}
+
+	kingBB := board.PieceBB[KingBB] & board.PieceBB[color] & MaskRank[backRank]
+	rooksBB := board.PieceBB[RookBB] & board.PieceBB[color] & MaskRank[backRank]
+	if kingBB == 0 {
+		return
+	}
+	kingFile := getLSBPos(kingBB) % 8
+
+	rookFile := -1
+	switch {
+	case char == 'K':
+		for file := FileH; file > kingFile; file-- {
+			if rooksBB&MaskFile[file] != 0 {
+				rookFile = file
+				break
+			}
+		}
+	case char == 'Q':
+		for file := FileA; file < kingFile; file++ {
+			if rooksBB&MaskFile[file] != 0 {
+				rookFile = file
+				break
+			}
+		}
+	case char >= 'A' && char <= 'H':
+		rookFile = int(char - 'A')
+	}
+
+	if rookFile == -1 || rookFile == kingFile {
+		return
+	}
+
+	kingside := rookFile > kingFile
+	rookSq := backRank*8 + rookFile
+	switch {
+	case color == WhiteBB && kingside:
+		board.CastlingRights |= WhiteKingside
+		board.CastlingRookSqs[WhiteKingsideRook] = rookSq
+	case color == WhiteBB:
+		board.CastlingRights |= WhiteQueenside
+		board.CastlingRookSqs[WhiteQueensideRook] = rookSq
+	case kingside:
+		board.CastlingRights |= BlackKingside
+		board.CastlingRookSqs[BlackKingsideRook] = rookSq
+	default:
+		board.CastlingRights |= BlackQueenside
+		board.CastlingRookSqs[BlackQueensideRook] = rookSq
+	}
+}
+
+// Get the FEN string of the current position. Loading the FEN string
+// returned with LoadFEN gives back the same position.
+func (board *Board) ToFEN() string {
+	var fen strings.Builder
+	for rankStartPos := 56; rankStartPos >= 0; rankStartPos -= 8 {
+		emptySquares := 0
+		for index := rankStartPos; index < rankStartPos+8; index++ {
+			square := board.Pieces[index]
+			if square == NoPiece {
+				emptySquares++
+				continue
+			}
+
+			if emptySquares != 0 {
+				fen.WriteByte(byte('0' + emptySquares))
+				emptySquares = 0
+			}
+			pieceChar := "pnbrqk"[GetPieceType(square)]
+			if PieceColor(square) == WhiteBB {
+				pieceChar -= 'a' - 'A'
+			}
+			fen.WriteByte(pieceChar)
+		}
+
+		if emptySquares != 0 {
+			fen.WriteByte(byte('0' + emptySquares))
+		}
+		if rankStartPos != 0 {
+			fen.WriteByte('/')
+		}
+	}
+
+	if board.WhiteToMove {
+		fen.WriteString(" w ")
+	} else {
+		fen.WriteString(" b ")
+	}
+
+	castling := board.castlingRightsToStr()
+	if castling == "" {
+		castling = "-"
+	}
+	fen.WriteString(castling)
+
+	if board.EPSquare == NoEPSquare {
+		fen.WriteString(" -")
+	} else {
+		fen.WriteString(" " + PosToCoordinate(board.EPSquare))
+	}
+
+	fmt.Fprintf(&fen, " %d %d", board.HalfMoveClock, board.FullMoveCounter)
+	return fen.String()
+}
+
+// Get the castling rights as they'd appear in a FEN string. The standard
+// KQkq letters are used when castling with a rook from its usual corner,
+// and the file of the rook (Shredder-FEN) is used otherwise.
+func (board *Board) castlingRightsToStr() (castling string) {
+	standardRookSqs := [4]int{H1, A1, H8, A8}
+	for rookIdx, char := range "KQkq" {
+		// The castling right flags are in the same order as the rook
+		// indices (WhiteKingsideRook, WhiteQueensideRook, ...).
+		if board.CastlingRights&(WhiteKingside>>rookIdx) == 0 {
+			continue
+		}
+
+		rookSq := board.CastlingRookSqs[rookIdx]
+		if rookSq == standardRookSqs[rookIdx] {
+			castling += string(char)
+		} else if rookIdx < BlackKingsideRook {
+			castling += string(rune('A' + rookSq%8))
+		} else {
+			castling += string(rune('a' + rookSq%8))
+		}
+	}
+	return castling
+}
+
+// Get the current phase of the game, computed from the non-pawn
+// material left on the board. A value of MaxPhase means all of the
+// starting material is present, and zero means only kings and pawns
+// are left. Extra material from promotions is capped at MaxPhase.
+func (board *Board) Phase() int {
+	phase := bits.OnesCount64(board.PieceBB[KnightBB])*KnightPhase +
+		bits.OnesCount64(board.PieceBB[BishopBB])*BishopPhase +
+		bits.OnesCount64(board.PieceBB[RookBB])*RookPhase +
+		bits.OnesCount64(board.PieceBB[QueenBB])*QueenPhase
+	return (min(phase, TotalPhase)*MaxPhase + TotalPhase/2) / TotalPhase
+}
+
+// Determine if the current position has occured before in the game. Only
+// the positions since the last capture or pawn move can be repeated, and
+// only those with the same side to move, every other ply back, are compared.
+// The earlier positions are only known for moves made with their state saved.
+func (board *Board) IsRepetition() bool {
+	for pliesBack := 2; pliesBack <= min(board.HalfMoveClock, board.gamePly+1); pliesBack += 2 {
+		if board.undoInfoList[board.gamePly+1-pliesBack].Hash == board.Hash {
+			return true
+		}
+	}
+	return false
 }
 
 // Determine when the endgame has been reached
 func (board *Board) IsEndgame() bool {
-	return bits.OnesCount64(board.PieceBB[WhiteBB]|board.PieceBB[BlackBB]) >= EndgameThreshold
+	return board.Phase() <= EndgameThreshold
+}
+
+// Determine if neither side has enough material left to ever checkmate
+// the other, regardless of how the game is played. This is the case
+// with bare kings, a single minor piece against a bare king, or when
+// the only pieces left are bishops which are all on the same color
+// squares. Positions like king and bishop versus king and knight are
+// not counted, since a mate is still possible, even if it can't be forced.
+func (board *Board) IsInsufficientMaterial() bool {
+	if board.PieceBB[PawnBB]|board.PieceBB[RookBB]|board.PieceBB[QueenBB] != 0 {
+		return false
+	}
+
+	knights := bits.OnesCount64(board.PieceBB[KnightBB])
+	bishops := bits.OnesCount64(board.PieceBB[BishopBB])
+	if knights+bishops <= 1 {
+		return true
+	}
+	if knights != 0 {
+		return false
+	}
+
+	// Only bishops are left, so check if they're all on
+	// the same color squares.
+	bishopsBB := board.PieceBB[BishopBB]
+	firstSq, _ := popLSB(&bishopsBB)
+	for bishopsBB != 0 {
+		sq, _ := popLSB(&bishopsBB)
+		if (sq/8+sq%8)%2 != (firstSq/8+firstSq%8)%2 {
+			return false
+		}
+	}
+	return true
 }
 
 // Determine whether the current color to move is in check
 func (board *Board) InCheck() bool {
 	if board.WhiteToMove {
-		kingBB := board.PieceBB[KingBB] & board.PieceBB[WhiteBB]
-		return squareIsAttacked(board, BlackBB, kingBB, board.PieceBB[WhiteBB])
+		return squareIsAttacked(board, BlackBB, setSingleBit(board.KingSq[WhiteBB]))
+	} else {
+		return squareIsAttacked(board, WhiteBB, setSingleBit(board.KingSq[BlackBB]))
+	}
+}
+
+// Get a bitboard of the enemy pieces giving check to the color to move.
+// This is the same set of checkers the move generator uses to decide
+// whether it needs to generate check evasions.
+func (board *Board) CheckersBB() uint64 {
+	if board.WhiteToMove {
+		return attackersOfSquare(board, BlackBB, setSingleBit(board.KingSq[WhiteBB]))
 	} else {
-		kingBB := board.PieceBB[KingBB] & board.PieceBB[BlackBB]
-		return squareIsAttacked(board, WhiteBB, kingBB, board.PieceBB[BlackBB])
+		return attackersOfSquare(board, WhiteBB, setSingleBit(board.KingSq[BlackBB]))
 	}
 }
 
+// Determine whether the color to move is in double check
+func (board *Board) IsDoubleCheck() bool {
+	return bits.OnesCount64(board.CheckersBB()) > 1
+}
+
+// Determine whether the color to move has been checkmated
+func (board *Board) IsCheckmate() bool {
+	return board.InCheck() && !board.hasLegalMoves()
+}
+
+// Determine whether the color to move has been stalemated
+func (board *Board) IsStalemate() bool {
+	return !board.InCheck() && !board.hasLegalMoves()
+}
+
+// Determine whether the color to move has any legal moves
+func (board *Board) hasLegalMoves() bool {
+	var moves []uint16
+	GenLegalMoves(board, &moves)
+	return len(moves) != 0
+}
+
 // A convinece function used to make a move on the board
 // using coordinate notation. This function is useful for
 // debugging and loading moves from the uci interface. It
@@ -629,7 +1107,7 @@ func (board *Board) PrintBoard() {
 		for index := rankStartPos; index < rankStartPos+8; index++ {
 			square := board.Pieces[index]
 			piece := GetPieceType(square)
-			color := getPieceColor(square)
+			color := PieceColor(square)
 			var squareChar rune
 			if square != NoPiece {
 				if piece == PawnBB {
@@ -711,6 +1189,14 @@ func GetPieceType(square uint8) int {
 }
 
 // Get a pieces color
-func getPieceColor(square uint8) int {
+func PieceColor(square uint8) int {
 	return int((square & ColorMask) >> 2)
 }
+
+// Get the type and color of the piece on the given square, as indexes into
+// Board.PieceBB, and whether the square is occupied at all. If it's empty,
+// the type and color returned are meaningless.
+func (board *Board) PieceAt(sq int) (pieceType int, color int, occupied bool) {
+	piece := board.Pieces[sq]
+	return GetPieceType(piece), PieceColor(piece), piece != NoPiece
+}
@@ -0,0 +1,9 @@
+//go:build debug
+// +build debug
+
+package core
+
+// Building with the debug tag (go build -tags debug) turns on extra
+// consistency checks throughout the engine, such as verifying the
+// board after every move is made or unmade.
+const DebugMode = true
@@ -0,0 +1,139 @@
+package core
+
+import "math/bits"
+
+/* This file contains the endgame knowledge of the engine. The piece
+square tables alone aren't enough to guide the engine in simple endgames,
+where it needs to know how to make progress, such as how to actually
+deliver mate with a rook or queen against a lone king, or how to escort
+a lone pawn to promotion.
+*/
+
+const (
+	// Weights for the "mop-up" evaluation used when mating a lone king.
+	// The first rewards pushing the losing king towards the edges and
+	// corners of the board, and the second rewards bringing the winning
+	// king closer to the losing king.
+	MopUpCornerWeight       = 10
+	MopUpKingDistanceWeight = 4
+
+	// Weights for the evaluation of king and pawn versus king endgames.
+	// The first is given for each rank the pawn has advanced, and the
+	// second for each square our king is closer to the promotion square
+	// than the enemy king. A pawn the enemy king can't catch is given the
+	// last bonus, since it's as good as a queen.
+	KPKPawnAdvanceWeight    = 10
+	KPKKingSupportWeight    = 8
+	KPKUnstoppablePawnBonus = 400
+)
+
+// The Manhattan distance of each square from the center of the board. This
+// is used to push a losing king to the edges and corners of the board when
+// trying to deliver mate.
+var CenterManhattanDistance [64]int = [64]int{
+	6, 5, 4, 3, 3, 4, 5, 6,
+	5, 4, 3, 2, 2, 3, 4, 5,
+	4, 3, 2, 1, 1, 2, 3, 4,
+	3, 2, 1, 0, 0, 1, 2, 3,
+	3, 2, 1, 0, 0, 1, 2, 3,
+	4, 3, 2, 1, 1, 2, 3, 4,
+	5, 4, 3, 2, 2, 3, 4, 5,
+	6, 5, 4, 3, 3, 4, 5, 6,
+}
+
+// Get the Manhattan distance between two squares
+func manhattanDistance(sq1, sq2 int) int {
+	return abs(sq1%8-sq2%8) + abs(sq1/8-sq2/8)
+}
+
+// Get the Chebyshev distance between two squares, which is the number
+// of moves a king needs to get from one to the other.
+func chebyshevDistance(sq1, sq2 int) int {
+	return max(abs(sq1%8-sq2%8), abs(sq1/8-sq2/8))
+}
+
+// Evaluate the endgame knowledge terms for a side. The mop-up evaluation
+// is always used, since mating a lone king can take a lot of material,
+// but the rest only apply once the endgame has been reached.
+func evaluateEndgame(board *Board, usColor, enemyColor int) (score int) {
+	score += evaluateMopUp(board, usColor, enemyColor)
+	if board.IsEndgame() {
+		score += evaluateKPK(board, usColor, enemyColor)
+	}
+	return score
+}
+
+// Determine if a side has enough material to force mate against
+// a lone king without needing to promote a pawn.
+func hasMatingMaterial(board *Board, usColor int) bool {
+	usBB := board.PieceBB[usColor]
+	bishops := bits.OnesCount64(board.PieceBB[BishopBB] & usBB)
+	knights := bits.OnesCount64(board.PieceBB[KnightBB] & usBB)
+	return board.PieceBB[QueenBB]&usBB != 0 || board.PieceBB[RookBB]&usBB != 0 ||
+		bishops >= 2 || (bishops >= 1 && knights >= 1)
+}
+
+// Evaluate how well a side is doing at mating a lone enemy king. This only
+// applies when the enemy has nothing but their king left, and we have enough
+// material to force mate. Progress is measured by how close the enemy king
+// has been pushed to the edge of the board, and how close our king is to
+// the enemy king, since our king is needed to help deliver mate.
+func evaluateMopUp(board *Board, usColor, enemyColor int) (score int) {
+	enemyBB := board.PieceBB[enemyColor]
+	enemyKing := board.PieceBB[KingBB] & enemyBB
+	if enemyBB != enemyKing || !hasMatingMaterial(board, usColor) {
+		return 0
+	}
+
+	usKingPos := board.KingSq[usColor]
+	enemyKingPos := getLSBPos(enemyKing)
+
+	score += CenterManhattanDistance[enemyKingPos] * MopUpCornerWeight
+	score += (14 - manhattanDistance(usKingPos, enemyKingPos)) * MopUpKingDistanceWeight
+	return score
+}
+
+// Evaluate a king and pawn versus king endgame for the side with the pawn.
+// By the "rule of the square", if the enemy king can't reach the promotion
+// square before the pawn does, the pawn can't be stopped. Otherwise, the
+// pawn needs the support of our king, so we're rewarded for advancing the
+// pawn and for our king being closer to the promotion square than the
+// enemy king.
+func evaluateKPK(board *Board, usColor, enemyColor int) (score int) {
+	usBB, enemyBB := board.PieceBB[usColor], board.PieceBB[enemyColor]
+	usPawns := board.PieceBB[PawnBB] & usBB
+	if enemyBB != board.PieceBB[KingBB]&enemyBB || bits.OnesCount64(usBB) != 2 || usPawns == 0 {
+		return 0
+	}
+
+	pawnPos := getLSBPos(usPawns)
+	usKingPos := getLSBPos(board.PieceBB[KingBB] & usBB)
+	enemyKingPos := getLSBPos(board.PieceBB[KingBB] & enemyBB)
+
+	promotionSq, startRank, frontSpan := 56+pawnPos%8, Rank2, WhitePassedPawnMasks[pawnPos]
+	if usColor == BlackBB {
+		promotionSq, startRank, frontSpan = pawnPos%8, Rank7, BlackPassedPawnMasks[pawnPos]
+	}
+	frontSpan &= MaskFile[pawnPos%8]
+
+	// A pawn on its starting rank can move two squares at once, and if it's
+	// the enemy's move, their king gets a move closer before the pawn moves.
+	pawnDistance := abs(promotionSq/8 - pawnPos/8)
+	if pawnPos/8 == startRank {
+		pawnDistance--
+	}
+	enemyKingDistance := chebyshevDistance(enemyKingPos, promotionSq)
+	if board.WhiteToMove != (usColor == WhiteBB) {
+		enemyKingDistance--
+	}
+
+	// Our own king can get in the way of the pawn, so it's only unstoppable
+	// if its path is clear.
+	if pawnDistance < enemyKingDistance && frontSpan&usBB == 0 {
+		return KPKUnstoppablePawnBonus
+	}
+
+	score += (6 - pawnDistance) * KPKPawnAdvanceWeight
+	score += (chebyshevDistance(enemyKingPos, promotionSq) - chebyshevDistance(usKingPos, promotionSq)) * KPKKingSupportWeight
+	return score
+}
@@ -20,168 +20,713 @@ const (
 	// Value of a draw
 	DrawValue = 0
 
-	// Indexes into the PieceSquareTables array for the king middle and endgame
-	// piece square tables.
-	KingPSTMiddlegameIndex = 3
-	KingPSTEndgameIndex    = 4
+	// The evaluation is scaled towards a draw as the half-move clock
+	// counts up to the fifty-move rule, by the clock out of this value,
+	// so it's halved by the time the game would be drawn.
+	FiftyMoveScaleFactor = FiftyMoveRuleLimit * 2
+
+	// The bonus given to the side to move, since having the move is
+	// worth something in itself.
+	TempoBonus = 10
+
+	// Indexes into the tapered evaluation tables (e.g. the piece square
+	// tables) for the middle game and the endgame.
+	MG = 0
+	EG = 1
+
+	// Masks of the four central squares, and the ring of squares around
+	// them that make up the rest of the extended center (c3-f6).
+	CenterMask         uint64 = 0x1818000000
+	ExtendedCenterMask uint64 = 0x3C24243C0000
 )
 
-// Table containg piece square tables for each piece, indexed
-// by their bitboard index (see the constants in board.go)
-var PieceSquareTables [8][64]int = [8][64]int{
-
-	// Piece-square table for pawns
-	{
-		25, 25, 25, 25, 25, 25, 25, 25,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		-5, -5, -5, -5, -5, -5, -5, -5,
-		-15, -2, 3, 15, 15, 3, -2, -15,
-		-15, 2, 5, 5, 5, 5, 2, -15,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-	},
+// Parameters of the evaluation that can be tuned, or turned off
+// entirely, without changing the evaluation code itself.
+type EvalParams struct {
+	// Whether the material imbalance term is used in the evaluation
+	UseImbalance bool
 
-	// Piece-square table for knights
-	{
-		-15, -15, -15, -15, -15, -15, -15, -15,
-		-2, -2, -2, -2, -2, -2, -2, -2,
-		-5, 0, 2, 2, 2, 2, 0, -5,
-		-5, 0, 15, 25, 25, 15, 0, -5,
-		-5, 0, 15, 25, 25, 15, 0, -5,
-		-5, 0, 25, 25, 25, 25, 0, -5,
-		-2, -2, -2, -2, -2, -2, -2, -2,
-		-15, -15, -15, -15, -15, -15, -15, -15,
-	},
+	// Adjustments to the value of each knight and rook, indexed by the
+	// number of friendly pawns on the board. Knights gain value with more
+	// pawns, since the position is more closed, while rooks lose value,
+	// since there are fewer open files for them to use.
+	KnightPawnAdjustments [9]int
+	RookPawnAdjustments   [9]int
+
+	// The penalty given for each major piece after the first, since two
+	// rooks, or a rook and a queen, partly do the same job.
+	MajorPieceRedundancyPenalty int
+
+	// The bonus given to a side for having two or more bishops, since
+	// together they can reach squares of both colors.
+	BishopPairBonus int
+
+	// The material value of each piece in the middle game and endgame,
+	// indexed by phase and then by the piece's bitboard index.
+	MaterialValues [2][5]int
+
+	// The piece square tables for each piece in the middle game and
+	// endgame, indexed by phase and then by the piece's bitboard index
+	// (see the constants in board.go). Only the king has different tables
+	// for the two phases so far.
+	PieceSquareTables [2][6][64]int
+
+	// Bonuses for passed pawns in the middle game and endgame, indexed by
+	// phase and then by the rank the pawn is on, relative to its side. The
+	// closer a passed pawn is to promoting, the larger the bonus, and passed
+	// pawns are worth more in the endgame, when there are fewer pieces left
+	// to stop them.
+	PassedPawnBonuses [2][8]int
+
+	// The bonus given for each square a knight, bishop, rook, or queen can
+	// move to, in the middle game and endgame, indexed by phase and then by
+	// the piece's bitboard index. Squares attacked by enemy pawns aren't
+	// counted, since a piece can't safely move to them.
+	MobilityWeights [2][5]int
+
+	// Bonuses given for friendly pawns sheltering the king, depending on
+	// whether they're on the second or third rank.
+	PawnShelterRank2Bonus int
+	PawnShelterRank3Bonus int
+
+	// The penalty for files around the king whose friendly pawns have all
+	// advanced past the third rank, and so no longer shelter it.
+	PawnShelterAdvancedPenalty int
+
+	// Penalties for files around the king with no friendly pawns on
+	// them. A file that is completely open (no pawns at all) is worse
+	// than one that is half-open (only enemy pawns).
+	KingOpenFilePenalty     int
+	KingHalfOpenFilePenalty int
+
+	// Penalties for enemy pawns storming towards the king, indexed by the
+	// rank the enemy pawn is on, relative to the side being evaluated. The
+	// closer the storming pawn is to the king, the larger the penalty.
+	PawnStormPenalties [8]int
 
-	// Piece-square table for bishops
-	{
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0,
-		2, 5, 5, 0, 0, 5, 5, 2,
-		2, 15, 5, 0, 0, 5, 15, 2,
-		2, -5, -25, 0, 0, -25, -5, 2,
+	// The weight each square of the king zone attacked by an enemy knight,
+	// bishop, rook, or queen adds to the danger the king is in, indexed by
+	// the attacking piece's bitboard index.
+	KingAttackWeights [5]int
+
+	// Bonuses given to rooks on open files (no pawns) and half-open
+	// files (only enemy pawns), and when two rooks are doubled on an
+	// open or half-open file.
+	RookOpenFileBonus     int
+	RookHalfOpenFileBonus int
+	DoubledRooksBonus     int
+
+	// Bonuses given to rooks behind a passed pawn on the same file, with
+	// nothing in between. A rook behind a friendly passed pawn supports its
+	// advance, and a rook behind an enemy passed pawn helps stop it.
+	RookBehindPassedPawnBonus      int
+	RookBehindEnemyPassedPawnBonus int
+
+	// The bonus given to a knight on an outpost: a square from the fourth
+	// to the sixth rank, relative to its side, which a friendly pawn
+	// defends and no enemy pawn can ever attack.
+	KnightOutpostBonus int
+
+	// Bonuses given for each central square a side attacks or occupies,
+	// and for each square of the extended center it attacks.
+	CenterAttackBonus         int
+	ExtendedCenterAttackBonus int
+	CenterOccupationBonus     int
+}
+
+// The evaluation parameters currently used by the engine
+var EvalParameters EvalParams = EvalParams{
+	UseImbalance:                true,
+	KnightPawnAdjustments:       [9]int{-30, -24, -18, -12, -6, 0, 6, 12, 18},
+	RookPawnAdjustments:         [9]int{60, 48, 36, 24, 12, 0, -12, -24, -36},
+	MajorPieceRedundancyPenalty: 10,
+	BishopPairBonus:             30,
+
+	MaterialValues: [2][5]int{
+		{PawnValue, KnightValue, BishopValue, RookValue, QueenValue},
+		{PawnValue, KnightValue, BishopValue, RookValue, QueenValue},
 	},
 
-	// Piece square table for kings in the middle game
-	{
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		-75, -75, -75, -75, -75, -75, -75, -75,
-		25, 25, -10, -50, -50, -10, 25, 25,
-		75, 50, 0, 0, 0, 0, 50, 75,
+	PieceSquareTables: [2][6][64]int{
+		MG: {
+			// Piece-square table for pawns
+			PawnBB: {
+				25, 25, 25, 25, 25, 25, 25, 25,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				-5, -5, -5, -5, -5, -5, -5, -5,
+				-15, -2, 3, 15, 15, 3, -2, -15,
+				-15, 2, 5, 5, 5, 5, 2, -15,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+
+			// Piece-square table for knights
+			KnightBB: {
+				-15, -15, -15, -15, -15, -15, -15, -15,
+				-2, -2, -2, -2, -2, -2, -2, -2,
+				-5, 0, 2, 2, 2, 2, 0, -5,
+				-5, 0, 15, 25, 25, 15, 0, -5,
+				-5, 0, 15, 25, 25, 15, 0, -5,
+				-5, 0, 25, 25, 25, 25, 0, -5,
+				-2, -2, -2, -2, -2, -2, -2, -2,
+				-15, -15, -15, -15, -15, -15, -15, -15,
+			},
+
+			// Piece-square table for bishops
+			BishopBB: {
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				2, 5, 5, 0, 0, 5, 5, 2,
+				2, 15, 5, 0, 0, 5, 15, 2,
+				2, -5, -25, 0, 0, -25, -5, 2,
+			},
+
+			// Piece-square table for rooks
+			RookBB: {
+				5, 5, 5, 5, 5, 5, 5, 5,
+				15, 20, 20, 20, 20, 20, 20, 15,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				0, 0, 0, 5, 5, 0, 0, 0,
+			},
+
+			// Piece-square table for queens
+			QueenBB: {
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+
+			// Piece square table for kings in the middle game
+			KingBB: {
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				-75, -75, -75, -75, -75, -75, -75, -75,
+				25, 25, -10, -50, -50, -10, 25, 25,
+				75, 50, 0, 0, 0, 0, 50, 75,
+			},
+		},
+
+		EG: {
+			// Piece-square table for pawns
+			PawnBB: {
+				25, 25, 25, 25, 25, 25, 25, 25,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				-5, -5, -5, -5, -5, -5, -5, -5,
+				-15, -2, 3, 15, 15, 3, -2, -15,
+				-15, 2, 5, 5, 5, 5, 2, -15,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+
+			// Piece-square table for knights
+			KnightBB: {
+				-15, -15, -15, -15, -15, -15, -15, -15,
+				-2, -2, -2, -2, -2, -2, -2, -2,
+				-5, 0, 2, 2, 2, 2, 0, -5,
+				-5, 0, 15, 25, 25, 15, 0, -5,
+				-5, 0, 15, 25, 25, 15, 0, -5,
+				-5, 0, 25, 25, 25, 25, 0, -5,
+				-2, -2, -2, -2, -2, -2, -2, -2,
+				-15, -15, -15, -15, -15, -15, -15, -15,
+			},
+
+			// Piece-square table for bishops
+			BishopBB: {
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				2, 5, 5, 0, 0, 5, 5, 2,
+				2, 15, 5, 0, 0, 5, 15, 2,
+				2, -5, -25, 0, 0, -25, -5, 2,
+			},
+
+			// Piece-square table for rooks
+			RookBB: {
+				5, 5, 5, 5, 5, 5, 5, 5,
+				15, 20, 20, 20, 20, 20, 20, 15,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				0, 0, 0, 5, 5, 0, 0, 0,
+			},
+
+			// Piece-square table for queens
+			QueenBB: {
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+
+			// Piece square table for kings in the endgame
+			KingBB: {
+				-10, -10, -10, -10, -10, -10, -10, -10,
+				-10, -5, -5, -5, -5, -5, -5, -10,
+				-10, 2, 5, 5, 5, 5, 2, -10,
+				-10, 2, 5, 25, 25, 5, 2, -10,
+				-10, 2, 5, 25, 25, 5, 2, -10,
+				-10, 2, 5, 5, 5, 5, 2, -10,
+				-10, -5, -5, -5, -5, -5, -5, -10,
+				-10, -10, -10, -10, -10, -10, -10, -10,
+			},
+		},
 	},
 
-	// Piece square table for kings in the endgame
-	{
-		-10, -10, -10, -10, -10, -10, -10, -10,
-		-10, -5, -5, -5, -5, -5, -5, -10,
-		-10, 2, 5, 5, 5, 5, 2, -10,
-		-10, 2, 5, 25, 25, 5, 2, -10,
-		-10, 2, 5, 25, 25, 5, 2, -10,
-		-10, 2, 5, 5, 5, 5, 2, -10,
-		-10, -5, -5, -5, -5, -5, -5, -10,
-		-10, -10, -10, -10, -10, -10, -10, -10,
+	PassedPawnBonuses: [2][8]int{
+		MG: {0, 5, 10, 15, 25, 40, 60, 0},
+		EG: {0, 10, 20, 35, 55, 85, 120, 0},
+	},
+	MobilityWeights: [2][5]int{
+		MG: {KnightBB: 4, BishopBB: 5, RookBB: 2, QueenBB: 1},
+		EG: {KnightBB: 4, BishopBB: 5, RookBB: 4, QueenBB: 2},
 	},
+
+	PawnShelterRank2Bonus:      10,
+	PawnShelterRank3Bonus:      5,
+	PawnShelterAdvancedPenalty: 10,
+	KingOpenFilePenalty:        25,
+	KingHalfOpenFilePenalty:    15,
+	PawnStormPenalties:         [8]int{0, 0, 25, 15, 5, 0, 0, 0},
+	KingAttackWeights:          [5]int{KnightBB: 2, BishopBB: 2, RookBB: 3, QueenBB: 5},
+
+	RookOpenFileBonus:              15,
+	RookHalfOpenFileBonus:          7,
+	DoubledRooksBonus:              15,
+	RookBehindPassedPawnBonus:      20,
+	RookBehindEnemyPassedPawnBonus: 10,
+	KnightOutpostBonus:             20,
+
+	CenterAttackBonus:         3,
+	ExtendedCenterAttackBonus: 1,
+	CenterOccupationBonus:     5,
 }
 
-// Values for various pieces that might surround and thus
-// help protect a king.
-var piecesAroundKingValues [6]int = [6]int{
-	// Pawn value
-	8,
-	// Knight value
-	12,
-	// Bishop value
-	12,
-	// Rook value
-	16,
-	// Queen value
-	88,
-	// King value
-	4,
+// The penalty for a king whose zone is being attacked, indexed by the total
+// weight of the attacks (see EvaluateKingSaftey). The penalty grows slowly
+// at first, and then faster and faster, until it levels off.
+var kingSafetyTable [64]int = [64]int{
+	0, 0, 1, 2, 3, 5, 7, 9, 12, 15, 18, 22, 26, 30, 35, 39,
+	44, 50, 56, 62, 68, 75, 82, 85, 89, 97, 105, 113, 122, 131, 140, 150,
+	169, 180, 191, 202, 213, 225, 237, 248, 260, 272, 283, 295, 307, 319, 330, 342,
+	354, 366, 377, 389, 401, 412, 424, 436, 448, 459, 471, 483, 494, 500, 500, 500,
 }
 
-// Evaluate a board state.
-func evaluateBoard(searcher *Searcher) (score int) {
-	whiteScore := evaluateSide(&searcher.Board, WhiteBB, BlackBB)
-	blackScore := evaluateSide(&searcher.Board, BlackBB, WhiteBB)
+// Information about a position that's computed once per evaluation
+// and shared between the evaluation of both sides.
+type evalInfo struct {
+	// The number of pawns each side has on each file, indexed
+	// first by color (WhiteBB or BlackBB) and then by file.
+	pawnsOnFile [8][8]int
+
+	// The passed pawns of each side, indexed by color.
+	passedPawns [8]uint64
 
-	if searcher.Board.WhiteToMove {
-		return whiteScore - blackScore
+	// The squares attacked by each side's pawns, indexed by color.
+	pawnAttacks [8]uint64
+}
+
+// Fill in the evaluation information for the current board.
+func (info *evalInfo) init(board *Board) {
+	whitePawns := board.PieceBB[PawnBB] & board.PieceBB[WhiteBB]
+	blackPawns := board.PieceBB[PawnBB] & board.PieceBB[BlackBB]
+	for file := FileA; file <= FileH; file++ {
+		info.pawnsOnFile[WhiteBB][file] = bits.OnesCount64(whitePawns & MaskFile[file])
+		info.pawnsOnFile[BlackBB][file] = bits.OnesCount64(blackPawns & MaskFile[file])
+	}
+
+	for pawnsBB := whitePawns; pawnsBB != 0; {
+		pawnPos, pawnBB := popLSB(&pawnsBB)
+		if WhitePassedPawnMasks[pawnPos]&blackPawns == 0 {
+			info.passedPawns[WhiteBB] |= pawnBB
+		}
+		info.pawnAttacks[WhiteBB] |= WhitePawnAttacks[pawnPos]
+	}
+	for pawnsBB := blackPawns; pawnsBB != 0; {
+		pawnPos, pawnBB := popLSB(&pawnsBB)
+		if BlackPassedPawnMasks[pawnPos]&whitePawns == 0 {
+			info.passedPawns[BlackBB] |= pawnBB
+		}
+		info.pawnAttacks[BlackBB] |= BlackPawnAttacks[pawnPos]
 	}
-	return blackScore - whiteScore
 }
 
-// Evaluate a board state for a side.
-func evaluateSide(board *Board, usColor, enemyColor int) (score int) {
-	score += evaluateMaterial(board, usColor)
-	score += evaluatePosition(board, usColor)
-	//score += EvaluateKingSaftey(board, usColor, enemyColor)
-	return score
+// Evaluate a board state, from the point of view of the side to move.
+func evaluateBoard(board *Board, attacks *attackInfo) (score int) {
+	var info evalInfo
+	info.init(board)
+	phase := board.Phase()
+	whiteScore := evaluateSide(board, &info, attacks, phase, WhiteBB, BlackBB)
+	blackScore := evaluateSide(board, &info, attacks, phase, BlackBB, WhiteBB)
+
+	score = whiteScore - blackScore
+	if !board.WhiteToMove {
+		score = -score
+	}
+	score += TempoBonus
+
+	// Make the engine prefer to reset the half-move clock, by pushing
+	// a pawn or capturing, if it's winning as the fifty-move rule nears.
+	return score * (FiftyMoveScaleFactor - board.HalfMoveClock) / FiftyMoveScaleFactor
+}
+
+// Get the static evaluation of a board, from the point of view of the side
+// to move. Unlike StaticEval, this doesn't need a searcher, which makes it
+// easy to evaluate many positions at once, such as when tuning.
+func Evaluate(board *Board) int {
+	var attacks attackInfo
+	attacks.init(board)
+	return evaluateBoard(board, &attacks)
 }
 
-// Evalute the material for a side.
-func evaluateMaterial(board *Board, usColor int) (score int) {
-	score += bits.OnesCount64(board.PieceBB[PawnBB]&board.PieceBB[usColor]) * PawnValue
-	score += bits.OnesCount64(board.PieceBB[KnightBB]&board.PieceBB[usColor]) * KnightValue
-	score += bits.OnesCount64(board.PieceBB[BishopBB]&board.PieceBB[usColor]) * BishopValue
-	score += bits.OnesCount64(board.PieceBB[RookBB]&board.PieceBB[usColor]) * RookValue
-	score += bits.OnesCount64(board.PieceBB[QueenBB]&board.PieceBB[usColor]) * QueenValue
+// Get the static evaluation of the current position, from the point of
+// view of the side to move, without searching it.
+func (searcher *Searcher) StaticEval() int {
+	return Evaluate(&searcher.Board)
+}
+
+// Evaluate a board state for a side. The material and piece square table
+// terms are evaluated for both the middle game and the endgame, and blended
+// together based on the phase of the game (see Board.Phase), so the evaluation
+// changes smoothly as pieces are traded off.
+func evaluateSide(board *Board, info *evalInfo, attacks *attackInfo, phase, usColor, enemyColor int) (score int) {
+	mgMaterial, egMaterial := evaluateMaterial(board, usColor)
+	mgPosition, egPosition := evaluatePosition(board, usColor)
+	mgPawns, egPawns := evaluatePawns(info, usColor)
+	mgMobility, egMobility := evaluateMobility(board, info, attacks, usColor, enemyColor)
+	mgScore := mgMaterial + mgPosition + mgPawns + mgMobility
+	egScore := egMaterial + egPosition + egPawns + egMobility
+	score += (mgScore*phase + egScore*(MaxPhase-phase)) / MaxPhase
+
+	// The king doesn't need sheltering once there isn't enough material
+	// left to attack it, so the pawn shelter counts for less and less as
+	// pieces are traded off, and not at all in the endgame.
+	if !board.IsEndgame() {
+		score += evaluatePawnShelter(board, usColor, enemyColor) * phase / MaxPhase
+	}
+	score += evaluateRooks(board, info, usColor, enemyColor)
+	score += evaluateKnightOutposts(board, info, usColor, enemyColor)
+	score += evaluateEndgame(board, usColor, enemyColor)
+	score += evaluateCenterControl(board, attacks, usColor)
+
+	// The bishop pair is only rewarded once, however many bishops a side
+	// has, after promoting to one.
+	if bits.OnesCount64(board.PieceBB[BishopBB]&board.PieceBB[usColor]) >= 2 {
+		score += EvalParameters.BishopPairBonus
+	}
+
+	if EvalParameters.UseImbalance {
+		score += evaluateImbalance(board, usColor)
+	}
+
+	// Like the pawn shelter, an attack on the king matters less and less
+	// as pieces are traded off.
+	score += evaluateKingSafety(board, attacks, usColor, enemyColor) * phase / MaxPhase
 	return score
 }
 
-// Evaluate the position of a side using piece square tables
-func evaluatePosition(board *Board, usColor int) (score int) {
-	usBB := board.PieceBB[usColor] & ^(board.PieceBB[RookBB] | board.PieceBB[QueenBB])
-	kingPos := getLSBPos(board.PieceBB[usColor] & board.PieceBB[KingBB])
+// Evalute the material for a side, in the middle game and endgame. The
+// scores are kept up to date by the board as moves are made.
+func evaluateMaterial(board *Board, usColor int) (mgScore, egScore int) {
+	return board.MaterialScores[MG][usColor], board.MaterialScores[EG][usColor]
+}
 
-	if board.IsEndgame() {
-		score += PieceSquareTables[KingPSTEndgameIndex][kingPos]
-	} else {
-		score += PieceSquareTables[KingPSTMiddlegameIndex][kingPos]
+// Evaluate the material imbalance for a side, adjusting the value of
+// its pieces based on the combination of pieces and pawns it has, which
+// evaluating the material of each piece on its own misses.
+func evaluateImbalance(board *Board, usColor int) (score int) {
+	usBB := board.PieceBB[usColor]
+	pawns := min(bits.OnesCount64(board.PieceBB[PawnBB]&usBB), 8)
+	knights := bits.OnesCount64(board.PieceBB[KnightBB] & usBB)
+	majors := bits.OnesCount64((board.PieceBB[RookBB] | board.PieceBB[QueenBB]) & usBB)
+	rooks := bits.OnesCount64(board.PieceBB[RookBB] & usBB)
+
+	score += knights * EvalParameters.KnightPawnAdjustments[pawns]
+	score += rooks * EvalParameters.RookPawnAdjustments[pawns]
+	if majors > 1 {
+		score -= (majors - 1) * EvalParameters.MajorPieceRedundancyPenalty
 	}
+	return score
+}
+
+// Evaluate how well a side controls the center, based on how many
+// central squares its pieces attack or occupy.
+func evaluateCenterControl(board *Board, attacks *attackInfo, usColor int) (score int) {
+	attacksBB := attacks.attacks[usColor]
+	piecesBB := board.PieceBB[usColor] & ^board.PieceBB[KingBB]
 
-	delta, perspective := 0, -1
+	score += bits.OnesCount64(attacksBB&CenterMask) * EvalParameters.CenterAttackBonus
+	score += bits.OnesCount64(attacksBB&ExtendedCenterMask) * EvalParameters.ExtendedCenterAttackBonus
+	score += bits.OnesCount64(piecesBB&CenterMask) * EvalParameters.CenterOccupationBonus
+	return score
+}
+
+// Evaluate the position of a side using piece square tables, in the
+// middle game and endgame. Like the material scores, the scores are
+// kept up to date by the board as moves are made.
+func evaluatePosition(board *Board, usColor int) (mgScore, egScore int) {
+	return board.PositionScores[MG][usColor], board.PositionScores[EG][usColor]
+}
+
+// Get the index of a square in the piece square tables for a side. The
+// tables are laid out from white's point of view, with a8 first, so
+// they're flipped for black.
+func pstIndex(sq, usColor int) int {
 	if usColor == WhiteBB {
-		delta, perspective = 63, 1
+		return 63 - sq
+	}
+	return sq
+}
+
+// Evaluate the pawn structure of a side, in the middle game and endgame.
+// Each of its passed pawns (see evalInfo) is given a bonus based on how
+// far it has advanced.
+func evaluatePawns(info *evalInfo, usColor int) (mgScore, egScore int) {
+	for passedPawnsBB := info.passedPawns[usColor]; passedPawnsBB != 0; {
+		pawnPos, _ := popLSB(&passedPawnsBB)
+		relativeRank := pawnPos / 8
+		if usColor == BlackBB {
+			relativeRank = 7 - relativeRank
+		}
+		mgScore += EvalParameters.PassedPawnBonuses[MG][relativeRank]
+		egScore += EvalParameters.PassedPawnBonuses[EG][relativeRank]
+	}
+	return mgScore, egScore
+}
+
+// Evaluate the mobility of a side, in the middle game and endgame, by
+// counting the squares each of its knights, bishops, rooks, and queens
+// can move to, not counting squares it occupies or enemy pawns attack.
+func evaluateMobility(board *Board, info *evalInfo, attacks *attackInfo, usColor, enemyColor int) (mgScore, egScore int) {
+	safeBB := ^board.PieceBB[usColor] & ^info.pawnAttacks[enemyColor]
+
+	for pieceType := KnightBB; pieceType <= QueenBB; pieceType++ {
+		for piecesBB := board.PieceBB[pieceType] & board.PieceBB[usColor]; piecesBB != 0; {
+			piecePos, _ := popLSB(&piecesBB)
+			moves := bits.OnesCount64(attacks.pieceAttacks[piecePos] & safeBB)
+			mgScore += moves * EvalParameters.MobilityWeights[MG][pieceType]
+			egScore += moves * EvalParameters.MobilityWeights[EG][pieceType]
+		}
+	}
+	return mgScore, egScore
+}
+
+// Get the squares a knight, bishop, rook, or queen on the given square
+// attacks, given the squares that are occupied.
+func genPieceAttacksBB(pieceType, piecePos int, pieceBB, occupiedBB uint64) uint64 {
+	switch pieceType {
+	case KnightBB:
+		return KnightMoves[piecePos]
+	case BishopBB:
+		return genIntercardianlMovesBB(pieceBB, occupiedBB)
+	case RookBB:
+		return genCardianlMovesBB(pieceBB, occupiedBB)
+	case QueenBB:
+		return genIntercardianlMovesBB(pieceBB, occupiedBB) | genCardianlMovesBB(pieceBB, occupiedBB)
+	}
+	return 0
+}
+
+// Evaluate the pawn shelter in front of a side's king, and any enemy pawns
+// storming towards it. The king's file and the files adjacent to it are
+// examined. Friendly pawns still on the second or third rank are rewarded,
+// files whose friendly pawns have all advanced further are penalized, files
+// with no friendly pawns are penalized more (more so if the file is fully
+// open), and enemy pawns advancing down these files are penalized based on
+// how close they are to the king. Since this only looks at the files around
+// the king, an uncastled king sitting in the center is also penalized as the
+// center files open up.
+func evaluatePawnShelter(board *Board, usColor, enemyColor int) (score int) {
+	kingPos := board.KingSq[usColor]
+	kingFile := kingPos % 8
+	usPawns := board.PieceBB[PawnBB] & board.PieceBB[usColor]
+	enemyPawns := board.PieceBB[PawnBB] & board.PieceBB[enemyColor]
+
+	shelterRank2, shelterRank3 := Rank2, Rank3
+	if usColor == BlackBB {
+		shelterRank2, shelterRank3 = Rank7, Rank6
+	}
+
+	for file := max(kingFile-1, FileA); file <= min(kingFile+1, FileH); file++ {
+		usPawnsOnFile := usPawns & MaskFile[file]
+		enemyPawnsOnFile := enemyPawns & MaskFile[file]
+
+		if usPawnsOnFile&MaskRank[shelterRank2] != 0 {
+			score += EvalParameters.PawnShelterRank2Bonus
+		} else if usPawnsOnFile&MaskRank[shelterRank3] != 0 {
+			score += EvalParameters.PawnShelterRank3Bonus
+		} else if usPawnsOnFile != 0 {
+			score -= EvalParameters.PawnShelterAdvancedPenalty
+		} else if enemyPawnsOnFile == 0 {
+			score -= EvalParameters.KingOpenFilePenalty
+		} else {
+			score -= EvalParameters.KingHalfOpenFilePenalty
+		}
+
+		for enemyPawnsOnFile != 0 {
+			pawnPos, _ := popLSB(&enemyPawnsOnFile)
+			relativeRank := pawnPos / 8
+			if usColor == BlackBB {
+				relativeRank = 7 - relativeRank
+			}
+			score -= EvalParameters.PawnStormPenalties[relativeRank]
+		}
 	}
-	for usBB != 0 {
-		piecePos, _ := popLSB(&usBB)
-		pieceType := GetPieceType(board.Pieces[piecePos])
-		score += PieceSquareTables[pieceType][(delta-piecePos)*perspective]
+	return score
+}
+
+// Evaluate the placement of a side's rooks. Rooks on open files are
+// rewarded, rooks on half-open files (no friendly pawns, but some enemy
+// pawns) are rewarded less, and two or more rooks doubled on the same
+// open or half-open file are given an extra bonus.
+func evaluateRooks(board *Board, info *evalInfo, usColor, enemyColor int) (score int) {
+	usRooks := board.PieceBB[RookBB] & board.PieceBB[usColor]
+	var rooksOnFile [8]int
+
+	for usRooks != 0 {
+		rookPos, _ := popLSB(&usRooks)
+		file := rookPos % 8
+		rooksOnFile[file]++
+
+		if info.pawnsOnFile[usColor][file] == 0 {
+			if info.pawnsOnFile[enemyColor][file] == 0 {
+				score += EvalParameters.RookOpenFileBonus
+			} else {
+				score += EvalParameters.RookHalfOpenFileBonus
+			}
+		}
+
+		if rookIsBehindPassedPawn(board, rookPos, info.passedPawns[usColor], usColor) {
+			score += EvalParameters.RookBehindPassedPawnBonus
+		}
+		if rookIsBehindPassedPawn(board, rookPos, info.passedPawns[enemyColor], enemyColor) {
+			score += EvalParameters.RookBehindEnemyPassedPawnBonus
+		}
+	}
+
+	for file := FileA; file <= FileH; file++ {
+		if rooksOnFile[file] >= 2 && info.pawnsOnFile[usColor][file] == 0 {
+			score += EvalParameters.DoubledRooksBonus
+		}
 	}
 	return score
 }
 
-// Evaluate the saftey of the king. The current method for doing this
-// is to figure out what kind of friendly and enemy pieces surround a king,
-// and return a score that's hopefully representive of how dangerous the situation
-// is for the king by getting the net score of thsi evaluation between both sides.
-func EvaluateKingSaftey(board *Board, usColor, enemyColor int) (score int) {
-	kingBB := board.PieceBB[KingBB] & board.PieceBB[usColor]
-	squaresAroundKing := SquaresAroundKing[getLSBPos(kingBB)] & ^kingBB
-	enemyPiecesAroundKing := squaresAroundKing & board.PieceBB[enemyColor]
-	for enemyPiecesAroundKing != 0 {
-		pos, _ := popLSB(&enemyPiecesAroundKing)
-		enemyPieceType := GetPieceType(board.Pieces[pos])
-		score -= piecesAroundKingValues[enemyPieceType]
-	}
-	/*friendlyPiecesAroundKing := squaresAroundKing & board.PieceBB[usColor]
-	for friendlyPiecesAroundKing != 0 {
-		pos, _ := popLSB(&friendlyPiecesAroundKing)
-		friendlyPieceType := GetPieceType(board.Pieces[pos])
-		score += piecesAroundKingValues[friendlyPieceType] * 2
-	}*/
+// Evaluate the knights of a side on outposts. A knight is on an outpost if
+// it's on the fourth to sixth rank, relative to its side, is defended by a
+// friendly pawn, and has no enemy pawns in front of it on the adjacent files,
+// so it can't be driven away by them.
+func evaluateKnightOutposts(board *Board, info *evalInfo, usColor, enemyColor int) (score int) {
+	usKnights := board.PieceBB[KnightBB] & board.PieceBB[usColor] & info.pawnAttacks[usColor]
+	enemyPawns := board.PieceBB[PawnBB] & board.PieceBB[enemyColor]
+	frontSpanMasks := &WhitePassedPawnMasks
+	if usColor == BlackBB {
+		frontSpanMasks = &BlackPassedPawnMasks
+	}
+
+	for usKnights != 0 {
+		knightPos, _ := popLSB(&usKnights)
+		relativeRank := knightPos / 8
+		if usColor == BlackBB {
+			relativeRank = 7 - relativeRank
+		}
+		if relativeRank < Rank4 || relativeRank > Rank6 {
+			continue
+		}
+
+		// The front span includes the knight's own file, but only pawns
+		// on the adjacent files can attack it.
+		adjacentFilesAhead := frontSpanMasks[knightPos] & ^MaskFile[knightPos%8]
+		if adjacentFilesAhead&enemyPawns == 0 {
+			score += EvalParameters.KnightOutpostBonus
+		}
+	}
 	return score
 }
 
+// Determine if a rook is behind one of the given passed pawns, which belong
+// to pawnColor, with no pieces between them. "Behind" is relative to the
+// direction the pawn moves in, so a rook behind a white passed pawn is below
+// it, and a rook behind a black passed pawn is above it.
+func rookIsBehindPassedPawn(board *Board, rookPos int, passedPawnsBB uint64, pawnColor int) bool {
+	occupiedBB := board.Occupied
+	passedPawnsBB &= MaskFile[rookPos%8]
+	for passedPawnsBB != 0 {
+		pawnPos, pawnBB := popLSB(&passedPawnsBB)
+		isBehind := rookPos < pawnPos
+		if pawnColor == BlackBB {
+			isBehind = rookPos > pawnPos
+		}
+		// The line between the rook and pawn includes the pawn's square
+		if isBehind && LinesBewteen[rookPos][pawnPos]&occupiedBB == pawnBB {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate the saftey of a side's king, from how heavily the enemy pieces
+// are attacking the squares around it (the king zone). Each enemy knight,
+// bishop, rook, or queen attacking the zone adds the weight of its piece
+// type for every square of the zone it attacks, and the total is looked up
+// in kingSafetyTable, which grows faster than the total does, so several
+// pieces attacking together are punished far more than any one of them
+// alone. A lone attacker can't do much on its own, so the king is only
+// counted as being in danger once at least two pieces are attacking it.
+func EvaluateKingSaftey(board *Board, usColor, enemyColor int) (score int) {
+	var attacks attackInfo
+	attacks.init(board)
+	return evaluateKingSafety(board, &attacks, usColor, enemyColor)
+}
+
+// Evaluate the saftey of a side's king, as EvaluateKingSaftey does, using
+// the attacks of the enemy pieces already computed for the position.
+func evaluateKingSafety(board *Board, attacks *attackInfo, usColor, enemyColor int) (score int) {
+	kingPos := board.KingSq[usColor]
+	kingZone := KingMoves[kingPos] | setSingleBit(kingPos)
+
+	attackers, attackWeight := 0, 0
+	for pieceType := KnightBB; pieceType <= QueenBB; pieceType++ {
+		for piecesBB := board.PieceBB[pieceType] & board.PieceBB[enemyColor]; piecesBB != 0; {
+			piecePos, _ := popLSB(&piecesBB)
+			zoneAttacksBB := attacks.pieceAttacks[piecePos] & kingZone
+			if zoneAttacksBB != 0 {
+				attackers++
+				attackWeight += bits.OnesCount64(zoneAttacksBB) * EvalParameters.KingAttackWeights[pieceType]
+			}
+		}
+	}
+
+	if attackers < 2 {
+		return 0
+	}
+	return -kingSafetyTable[min(attackWeight, len(kingSafetyTable)-1)]
+}
+
 // A convinece function to get a pieces value given
 // its bitboard index.
 func getPieceValue(pieceType int) int {
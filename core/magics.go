@@ -0,0 +1,128 @@
+package core
+
+import "math/bits"
+
+/* This file contains the tables used to generate the moves of sliding
+pieces with magic bitboards. For each square, only the squares a slider's
+moves could be blocked on matter (its "relevant occupancy"), and the moves
+from every possible occupancy of those squares are precomputed when the
+engine starts and stored in a table.
+
+To find the entry of an occupancy, the relevant occupancy is multiplied by a
+"magic" number, which is chosen so the top bits of the product are different
+for any two occupancies that give different moves. Those top bits are then
+used as the index into the square's part of the table. The magic numbers
+below were found by trial and error, by trying random numbers with few bits
+set until one worked for each square.
+*/
+
+const (
+	// The number of entries in the tables of bishop and rook moves. Each
+	// square gets two to the power of the number of its relevant occupancy
+	// squares entries.
+	BishopMovesTableSize = 5248
+	RookMovesTableSize   = 102400
+)
+
+// The information needed to look up a slider's moves from a square: the
+// mask of the square's relevant occupancy, the magic number, how far to
+// shift the product, and where the square's entries start in the table.
+type Magic struct {
+	Mask   uint64
+	Magic  uint64
+	Shift  uint8
+	Offset int
+}
+
+var BishopMagicNumbers [64]uint64 = [64]uint64{
+	0x10102002004a1420, 0x24002220020a0044, 0x24c0810d00080, 0x111208244209200,
+	0x1a0106010208844, 0x810000026211008, 0x1030412401180820, 0x28208200a02020,
+	0x2100222104020, 0x78200112420300, 0x40043050024000, 0x4422044242000,
+	0x5220200084040600, 0x10806206010c8110, 0x802120884041610, 0x8040480808088100,
+	0x2244102023c20, 0x284040488c410, 0x40080830400020, 0x8004088100400400,
+	0x28c0202018000104, 0x104430016804, 0x390c108805000800, 0x108c108864220810,
+	0x1411100020040, 0x7000c202208200, 0x1001011200410800, 0x8009010400060020,
+	0x202020080080, 0x3004024900080208, 0x8114100d00068c00, 0x142500480c10804,
+	0x430000410840, 0x2184002011001, 0x18041000200a200, 0x840005802000,
+	0x894080000220040, 0x4020004102402, 0x10048488012408, 0x4210103108218100,
+	0x188480080441001, 0x1000811422015040, 0x200400608200400, 0x8481000820083280,
+	0x4008048486004140, 0x2100a808090510, 0x1002000408220400, 0x405810888880801,
+	0x100442420a300200, 0x80080b0082104, 0x44402400300, 0xb0c040420882000,
+	0x2840082040400100, 0x80800c10a0008, 0xa08080500d4, 0x41010014101,
+	0x4a49010080844050, 0x5b38205504080a1, 0xc81042006001002, 0x202104801060a,
+	0x404019c88d000, 0x8180100201002, 0x8890041800404102, 0x2010200081044908,
+}
+
+var RookMagicNumbers [64]uint64 = [64]uint64{
+	0x100002404890942, 0xa010880201101094, 0x24100040008a251, 0x3012000904102002,
+	0x6a004008201106, 0x92040100a002082, 0x20804001002011, 0x44b10480044021,
+	0x1042006100840200, 0x1005800200010080, 0x120a00051008e200, 0x2080011010500,
+	0x412811004880080, 0x1084010200100, 0x8642400221048100, 0x130400280092080,
+	0x80104082450a0004, 0x2000401420088, 0x941a001020040400, 0x80c0080005010010,
+	0x608c100008008080, 0x2004820820010, 0x2180500020024000, 0x180002001d14000,
+	0x4208006902000084, 0xa020880204002110, 0x1020080104c0, 0x824008008080040,
+	0x10008010800804, 0x810801000802004, 0x40010100208c, 0x2020804000800020,
+	0x1288200041041, 0x4001000100040200, 0x4a02008080040002, 0x14040080080080,
+	0x1830080080100082, 0x10804200201200, 0x903400280200081, 0x40400080208000,
+	0x2020001009044, 0x440002500881, 0x8082080120104004, 0x8008008040080,
+	0x2010008010800800, 0x10150020010240, 0x10004000200040, 0xc61050020800040,
+	0x24c1002548830002, 0x3002000801040200, 0x202808004001200, 0x2000820060010,
+	0x20801000800800, 0xa200802000100081, 0x80a1002081004000, 0x208800090400020,
+	0x200020081004824, 0x4200008200082104, 0xe00020010880441, 0x11800401800a0800,
+	0x100100004200901, 0x200220040800810, 0x240044020001008, 0x2280001020400080,
+}
+
+var BishopMagics [64]Magic
+var RookMagics [64]Magic
+
+var BishopMoves [BishopMovesTableSize]uint64
+var RookMoves [RookMovesTableSize]uint64
+
+func init() {
+	offset := 0
+	for sq := 0; sq < 64; sq++ {
+		BishopMagics[sq] = Magic{Magic: BishopMagicNumbers[sq], Offset: offset}
+		offset += initMagic(sq, &BishopMagics[sq], BishopMoves[offset:], genHyperbolaIntercardinalMovesBB)
+	}
+
+	offset = 0
+	for sq := 0; sq < 64; sq++ {
+		RookMagics[sq] = Magic{Magic: RookMagicNumbers[sq], Offset: offset}
+		offset += initMagic(sq, &RookMagics[sq], RookMoves[offset:], genHyperbolaCardinalMovesBB)
+	}
+}
+
+// Compute the mask and shift of a slider's magic on the given square, and
+// fill in its entries in the table of moves, using genMovesBB to calculate
+// the moves from each occupancy. The number of entries used is returned.
+func initMagic(sq int, magic *Magic, table []uint64, genMovesBB func(sliderBB, occupiedBB uint64) uint64) int {
+	sliderBB := setSingleBit(sq)
+
+	// The squares on the edge of the board can't block any moves, since
+	// there are no squares past them, so they're left out of the mask,
+	// unless the slider is on the same edge.
+	edgesBB := ((MaskRank[Rank1] | MaskRank[Rank8]) & ^MaskRank[sq/8]) |
+		((MaskFile[FileA] | MaskFile[FileH]) & ^MaskFile[sq%8])
+	magic.Mask = genMovesBB(sliderBB, sliderBB) & ^edgesBB
+	magic.Shift = uint8(64 - bits.OnesCount64(magic.Mask))
+	size := 1 << bits.OnesCount64(magic.Mask)
+
+	// Enumerate every subset of the mask using the Carry-Rippler trick.
+	filledIn := make([]bool, size)
+	var occupancy uint64
+	for {
+		entry := (occupancy * magic.Magic) >> magic.Shift
+		moves := genMovesBB(sliderBB, occupancy|sliderBB)
+		if filledIn[entry] && table[entry] != moves {
+			panic("magic number collision")
+		}
+		filledIn[entry] = true
+		table[entry] = moves
+
+		occupancy = (occupancy - magic.Mask) & magic.Mask
+		if occupancy == 0 {
+			break
+		}
+	}
+	return size
+}
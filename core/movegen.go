@@ -36,6 +36,10 @@ const (
 	F1_G1, B1_C1_D1 = 0x600000000000000, 0x7000000000000000
 	F8_G8, B8_C8_D8 = 0x6, 0x70
 
+	// These masks help determine whether or not the squares the king
+	// passes through when castling queenside are attacked
+	C1_D1, C8_D8 = 0x3000000000000000, 0x30
+
 	// Constants representing the squares involved in castling
 	A1, C1, D1, E1, F1, G1, H1 = 0, 2, 3, 4, 5, 6, 7
 	A8, C8, D8, E8, F8, G8, H8 = 56, 58, 59, 60, 61, 62, 63
@@ -44,6 +48,12 @@ const (
 	TTPerftSize = 0x100000 * 2
 )
 
+// The squares the king and rook end up on for each castling right,
+// indexed in the same order as Board.CastlingRookSqs. These are the
+// same in Chess960 as in standard chess, wherever the pieces start.
+var CastlingKingDestSqs = [4]int{G1, C1, G8, C8}
+var CastlingRookDestSqs = [4]int{F1, D1, F8, D8}
+
 // Struct that holds perft entries
 type PerftTTEntry struct {
 	Hash  uint64
@@ -105,6 +115,12 @@ func MoveToStr(move uint16) string {
 
 // Compute all legal moves for the given side in the current position
 func GenLegalMoves(board *Board, moves *[]uint16) {
+	genLegalMoves(board, nil, moves)
+}
+
+// Compute all legal moves for the side to move, using the attack
+// information for the current position, if it's already been computed.
+func genLegalMoves(board *Board, attacks *attackInfo, moves *[]uint16) {
 	usColor := BlackBB
 	enemyColor := WhiteBB
 	if board.WhiteToMove {
@@ -119,21 +135,265 @@ func GenLegalMoves(board *Board, moves *[]uint16) {
 	bishopsBB := board.PieceBB[BishopBB] & usBB
 	rooksBB := board.PieceBB[RookBB] & usBB
 	queensBB := board.PieceBB[QueenBB] & usBB
-	kingBB := board.PieceBB[KingBB] & usBB
+	kingSq := board.KingSq[usColor]
+	kingBB := setSingleBit(kingSq)
+
+	// If the attacks for the position have already been computed, and
+	// they show we aren't in check, there's no need to find the checkers.
+	var checkersBB uint64
+	if attacks == nil || attacks.inCheck(board) {
+		checkersBB = board.CheckersBB()
+	}
+
+	// Compute every square the enemy attacks once, rather than asking
+	// whether each square the king might move to is attacked. Our king is
+	// removed from the board first, so enemy sliders "xray" through it,
+	// and the king can't slide back along the line of a checking slider.
+	// When we aren't in check, no enemy slider reaches our king, so the
+	// attacks already computed for the position can be used instead. If
+	// the king is boxed in by its own pieces, it has no moves (and can't
+	// castle), so there's no need to compute the attacks at all.
+	var enemyAttacksBB uint64
+	if attacks != nil && checkersBB == 0 {
+		enemyAttacksBB = attacks.attacks[enemyColor]
+	} else if KingMoves[kingSq] & ^usBB != 0 {
+		enemyAttacksBB = genAttacksBB(board, enemyColor, board.Occupied & ^kingBB)
+	}
 
-	checkersBB := attackersOfSquare(board, enemyColor, kingBB, usBB)
 	notPinnedMask := ^genPinnedPiecesMoves(board, enemyColor, usColor, kingBB, moves)
 	if bits.OnesCount64(checkersBB) == 0 {
 		genPawnMoves(board, pawnsBB&notPinnedMask, enemyBB, usBB, moves)
 		genKnightMoves(knightsBB&notPinnedMask, enemyBB, usBB, moves)
-		genBishopMoves(bishopsBB&notPinnedMask, enemyBB, usBB, moves)
-		genRookMoves(rooksBB&notPinnedMask, enemyBB, usBB, moves)
-		genQueenMoves(queensBB&notPinnedMask, enemyBB, usBB, moves)
-		genKingMoves(board, enemyColor, kingBB, usBB, moves)
-		genCastlingMoves(board, enemyColor, usBB, moves)
+		genBishopMoves(board, bishopsBB&notPinnedMask, enemyBB, usBB, moves)
+		genRookMoves(board, rooksBB&notPinnedMask, enemyBB, usBB, moves)
+		genQueenMoves(board, queensBB&notPinnedMask, enemyBB, usBB, moves)
+		genKingMoves(kingSq, enemyBB, usBB, enemyAttacksBB, moves)
+		if board.Chess960 {
+			genChess960CastlingMoves(board, usColor, enemyColor, kingBB, moves)
+		} else {
+			genCastlingMoves(board, enemyAttacksBB, moves)
+		}
 	} else {
 		*moves = (*moves)[:0]
-		genCheckEvasionMoves(board, enemyColor, usColor, kingBB, checkersBB, notPinnedMask, moves)
+		genCheckEvasionMoves(board, enemyColor, usColor, kingBB, checkersBB, notPinnedMask, enemyAttacksBB, moves)
+	}
+}
+
+// Compute a bitboard of every square attacked by the given color, with
+// the given occupancy used to block the rays of its sliding pieces.
+func genAttacksBB(board *Board, color int, occupiedBB uint64) (attacksBB uint64) {
+	colorBB := board.PieceBB[color]
+	pawnsBB := board.PieceBB[PawnBB] & colorBB
+	knightsBB := board.PieceBB[KnightBB] & colorBB
+	diagonalSlidersBB := (board.PieceBB[BishopBB] | board.PieceBB[QueenBB]) & colorBB
+	orthogonalSlidersBB := (board.PieceBB[RookBB] | board.PieceBB[QueenBB]) & colorBB
+	kingBB := board.PieceBB[KingBB] & colorBB
+
+	pawnAttacks := &BlackPawnAttacks
+	if color == WhiteBB {
+		pawnAttacks = &WhitePawnAttacks
+	}
+	for pawnsBB != 0 {
+		from, _ := popLSB(&pawnsBB)
+		attacksBB |= pawnAttacks[from]
+	}
+	for knightsBB != 0 {
+		from, _ := popLSB(&knightsBB)
+		attacksBB |= KnightMoves[from]
+	}
+	for diagonalSlidersBB != 0 {
+		_, fromBB := popLSB(&diagonalSlidersBB)
+		attacksBB |= genIntercardianlMovesBB(fromBB, occupiedBB)
+	}
+	for orthogonalSlidersBB != 0 {
+		_, fromBB := popLSB(&orthogonalSlidersBB)
+		attacksBB |= genCardianlMovesBB(fromBB, occupiedBB)
+	}
+	if kingBB != 0 {
+		attacksBB |= KingMoves[getLSBPos(kingBB)]
+	}
+	return attacksBB
+}
+
+// Compute a bitboard of every square attacked by the pieces of the given
+// color (WhiteBB or BlackBB) in the current position. Squares occupied by
+// either side count as attacked, so this can be used for mobility, king
+// safety, and threats, as well as for showing attacks in a GUI.
+func AttackMap(board *Board, color int) uint64 {
+	return genAttacksBB(board, color, board.Occupied)
+}
+
+// The squares attacked by each side in a position, and by each of their
+// knights, bishops, rooks, and queens. The search computes this once per
+// node, and shares it between the move generator and the evaluation, which
+// would otherwise each work out the same attacks for themselves.
+type attackInfo struct {
+	// The squares attacked by each side, indexed by color (WhiteBB or
+	// BlackBB), the same as AttackMap.
+	attacks [8]uint64
+
+	// The squares attacked by the knight, bishop, rook, or queen on each
+	// square. Only the entries for squares holding one of those pieces
+	// are filled in.
+	pieceAttacks [64]uint64
+}
+
+// Fill in the attack information for the current board.
+func (info *attackInfo) init(board *Board) {
+	occupiedBB := board.Occupied
+	for _, color := range [2]int{WhiteBB, BlackBB} {
+		colorBB := board.PieceBB[color]
+		pawnAttacks := &BlackPawnAttacks
+		if color == WhiteBB {
+			pawnAttacks = &WhitePawnAttacks
+		}
+
+		var attacksBB uint64
+		for pawnsBB := board.PieceBB[PawnBB] & colorBB; pawnsBB != 0; {
+			from, _ := popLSB(&pawnsBB)
+			attacksBB |= pawnAttacks[from]
+		}
+		for pieceType := KnightBB; pieceType <= QueenBB; pieceType++ {
+			for piecesBB := board.PieceBB[pieceType] & colorBB; piecesBB != 0; {
+				from, fromBB := popLSB(&piecesBB)
+				info.pieceAttacks[from] = genPieceAttacksBB(pieceType, from, fromBB, occupiedBB)
+				attacksBB |= info.pieceAttacks[from]
+			}
+		}
+		if kingBB := board.PieceBB[KingBB] & colorBB; kingBB != 0 {
+			attacksBB |= KingMoves[getLSBPos(kingBB)]
+		}
+		info.attacks[color] = attacksBB
+	}
+}
+
+// Determine whether the side to move is in check, like Board.InCheck.
+func (info *attackInfo) inCheck(board *Board) bool {
+	if board.WhiteToMove {
+		return info.attacks[BlackBB]&setSingleBit(board.KingSq[WhiteBB]) != 0
+	}
+	return info.attacks[WhiteBB]&setSingleBit(board.KingSq[BlackBB]) != 0
+}
+
+// Compute all legal captures for the side to move in the current position,
+// including en passant captures and promotions which capture a piece. This
+// is much cheaper than generating every legal move and throwing away the quiet
+// ones, which is what the quiescence search would otherwise have to do.
+func GenCaptureMoves(board *Board, moves *[]uint16) {
+	genCaptureMoves(board, nil, moves)
+}
+
+// Compute all legal captures for the side to move, using the attack
+// information for the current position, if it's already been computed.
+func genCaptureMoves(board *Board, attacks *attackInfo, moves *[]uint16) {
+	usColor := BlackBB
+	enemyColor := WhiteBB
+	if board.WhiteToMove {
+		usColor = WhiteBB
+		enemyColor = BlackBB
+	}
+
+	// When in check there are only a few legal moves, so rather than
+	// duplicating the check evasion logic, just pick out the captures.
+	if (attacks == nil || attacks.inCheck(board)) && board.CheckersBB() != 0 {
+		var evasions []uint16
+		GenLegalMoves(board, &evasions)
+		appendCaptures(board, evasions, moves)
+		return
+	}
+
+	enemyBB := board.PieceBB[enemyColor]
+	usBB := board.PieceBB[usColor]
+	occupiedBB := board.Occupied
+	kingBB := setSingleBit(board.KingSq[usColor])
+
+	// Pinned pieces have few moves, so the captures are picked out
+	// from all of their moves in the same way.
+	var pinnedMoves []uint16
+	notPinnedMask := ^genPinnedPiecesMoves(board, enemyColor, usColor, kingBB, &pinnedMoves)
+	appendCaptures(board, pinnedMoves, moves)
+
+	genPawnCaptures(board, board.PieceBB[PawnBB]&usBB&notPinnedMask, enemyBB, moves)
+
+	knightsBB := board.PieceBB[KnightBB] & usBB & notPinnedMask
+	for knightsBB != 0 {
+		from, _ := popLSB(&knightsBB)
+		genMovesFromBB(from, KnightMoves[from]&enemyBB, enemyBB, moves)
+	}
+
+	diagonalSlidersBB := (board.PieceBB[BishopBB] | board.PieceBB[QueenBB]) & usBB & notPinnedMask
+	for diagonalSlidersBB != 0 {
+		from, fromBB := popLSB(&diagonalSlidersBB)
+		genMovesFromBB(from, genIntercardianlMovesBB(fromBB, occupiedBB)&enemyBB, enemyBB, moves)
+	}
+
+	orthogonalSlidersBB := (board.PieceBB[RookBB] | board.PieceBB[QueenBB]) & usBB & notPinnedMask
+	for orthogonalSlidersBB != 0 {
+		from, fromBB := popLSB(&orthogonalSlidersBB)
+		genMovesFromBB(from, genCardianlMovesBB(fromBB, occupiedBB)&enemyBB, enemyBB, moves)
+	}
+
+	// Only compute the squares the enemy attacks if the king has
+	// something to capture. We aren't in check, so our king doesn't
+	// block any enemy slider, and the cached attacks can be used.
+	kingPos := board.KingSq[usColor]
+	if kingCaptures := KingMoves[kingPos] & enemyBB; kingCaptures != 0 {
+		var enemyAttacksBB uint64
+		if attacks != nil {
+			enemyAttacksBB = attacks.attacks[enemyColor]
+		} else {
+			enemyAttacksBB = genAttacksBB(board, enemyColor, occupiedBB & ^kingBB)
+		}
+		genMovesFromBB(kingPos, kingCaptures & ^enemyAttacksBB, enemyBB, moves)
+	}
+}
+
+// Generate the pawn captures, en passant captures, and promotions which
+// capture a piece, for the side to move.
+func genPawnCaptures(board *Board, pawnsBB, enemyBB uint64, moves *[]uint16) {
+	usColor, enemyColor := BlackBB, WhiteBB
+	pawnAttacks, epCaptureOffset, promotionRank := &BlackPawnAttacks, 8, Rank1
+	if board.WhiteToMove {
+		usColor, enemyColor = WhiteBB, BlackBB
+		pawnAttacks, epCaptureOffset, promotionRank = &WhitePawnAttacks, -8, Rank8
+	}
+	ourKing := board.PieceBB[KingBB] & board.PieceBB[usColor]
+
+	for pawnsBB != 0 {
+		from, _ := popLSB(&pawnsBB)
+		attacksBB := pawnAttacks[from] & enemyBB
+		for attacksBB != 0 {
+			to, _ := popLSB(&attacksBB)
+			if to/8 == promotionRank {
+				makePromotionMoves(from, to, moves)
+			} else {
+				*moves = append(*moves, MakeMove(from, to, Attack))
+			}
+		}
+
+		if board.EPSquare != NoEPSquare && pawnAttacks[from]&setSingleBit(board.EPSquare) != 0 {
+			// Make sure the en passant capture doesn't leave our king in check,
+			// the same way genWhitePawnMoves and genBlackPawnMoves do.
+			to, capturePos := board.EPSquare, board.EPSquare+epCaptureOffset
+			board.movePiece(from, to)
+			board.removePiece(capturePos)
+			if !squareIsAttacked(board, enemyColor, ourKing) {
+				*moves = append(*moves, MakeMove(from, to, AttackEP))
+			}
+			board.movePiece(to, from)
+			board.putPiece(PawnBB, enemyColor, capturePos)
+		}
+	}
+}
+
+// Append the moves which capture a piece from a list of legal moves,
+// to another list of moves.
+func appendCaptures(board *Board, legalMoves []uint16, moves *[]uint16) {
+	for _, move := range legalMoves {
+		_, to, moveType := GetMoveInfo(move)
+		if moveType == Attack || moveType == AttackEP || (moveType >= KnightPromotion && board.Pieces[to] != NoPiece) {
+			*moves = append(*moves, move)
+		}
 	}
 }
 
@@ -151,8 +411,8 @@ func genWhitePawnMoves(board *Board, pawnsBB, enemyBB, usBB uint64, epSq int, mo
 	ourKing := board.PieceBB[KingBB] & board.PieceBB[WhiteBB]
 	for pawnsBB != 0 {
 		from, _ := popLSB(&pawnsBB)
-		pawnOnePush := WhitePawnPushes[from] & ^(usBB | enemyBB)
-		pawnPush := pawnOnePush | ((pawnOnePush&MaskRank[Rank3])>>8) & ^(usBB|enemyBB)
+		pawnOnePush := WhitePawnPushes[from] & ^board.Occupied
+		pawnPush := pawnOnePush | ((pawnOnePush&MaskRank[Rank3])>>8) & ^board.Occupied
 		pawnAttacks := WhitePawnAttacks[from]
 		for pawnPush != 0 {
 			to, _ := popLSB(&pawnPush)
@@ -171,7 +431,7 @@ func genWhitePawnMoves(board *Board, pawnsBB, enemyBB, usBB uint64, epSq int, mo
 				capturePos := to - 8
 				board.movePiece(from, to)
 				board.removePiece(capturePos)
-				if !squareIsAttacked(board, BlackBB, ourKing, board.PieceBB[WhiteBB]) {
+				if !squareIsAttacked(board, BlackBB, ourKing) {
 					*moves = append(*moves, MakeMove(from, to, AttackEP))
 				}
 				board.movePiece(to, from)
@@ -192,8 +452,8 @@ func genBlackPawnMoves(board *Board, pawnsBB, enemyBB, usBB uint64, epSq int, mo
 	ourKing := board.PieceBB[KingBB] & board.PieceBB[BlackBB]
 	for pawnsBB != 0 {
 		from, _ := popLSB(&pawnsBB)
-		pawnOnePush := BlackPawnPushes[from] & ^(usBB | enemyBB)
-		pawnPush := pawnOnePush | ((pawnOnePush&MaskRank[Rank6])<<8) & ^(usBB|enemyBB)
+		pawnOnePush := BlackPawnPushes[from] & ^board.Occupied
+		pawnPush := pawnOnePush | ((pawnOnePush&MaskRank[Rank6])<<8) & ^board.Occupied
 		pawnAttacks := BlackPawnAttacks[from]
 		for pawnPush != 0 {
 			to, _ := popLSB(&pawnPush)
@@ -212,7 +472,7 @@ func genBlackPawnMoves(board *Board, pawnsBB, enemyBB, usBB uint64, epSq int, mo
 				capturePos := to + 8
 				board.movePiece(from, to)
 				board.removePiece(capturePos)
-				if !squareIsAttacked(board, WhiteBB, ourKing, board.PieceBB[BlackBB]) {
+				if !squareIsAttacked(board, WhiteBB, ourKing) {
 					*moves = append(*moves, MakeMove(from, to, AttackEP))
 				}
 				board.movePiece(to, from)
@@ -252,10 +512,10 @@ func genKnightMoves(knightsBB, enemyBB, usBB uint64, moves *[]uint16) {
 }
 
 // Generate bishop moves
-func genBishopMoves(bishopsBB, enemyBB, usBB uint64, moves *[]uint16) {
+func genBishopMoves(board *Board, bishopsBB, enemyBB, usBB uint64, moves *[]uint16) {
 	for bishopsBB != 0 {
 		from, fromBB := popLSB(&bishopsBB)
-		bishopMoves := genIntercardianlMovesBB(fromBB, enemyBB|usBB) & ^usBB
+		bishopMoves := genIntercardianlMovesBB(fromBB, board.Occupied) & ^usBB
 		for bishopMoves != 0 {
 			to, toBB := popLSB(&bishopMoves)
 			moveType := Quiet
@@ -268,10 +528,10 @@ func genBishopMoves(bishopsBB, enemyBB, usBB uint64, moves *[]uint16) {
 }
 
 // Generate rook moves
-func genRookMoves(rooksBB, enemyBB, usBB uint64, moves *[]uint16) {
+func genRookMoves(board *Board, rooksBB, enemyBB, usBB uint64, moves *[]uint16) {
 	for rooksBB != 0 {
 		from, fromBB := popLSB(&rooksBB)
-		bishopMoves := genCardianlMovesBB(fromBB, enemyBB|usBB) & ^usBB
+		bishopMoves := genCardianlMovesBB(fromBB, board.Occupied) & ^usBB
 		for bishopMoves != 0 {
 			to, toBB := popLSB(&bishopMoves)
 			moveType := Quiet
@@ -284,21 +544,16 @@ func genRookMoves(rooksBB, enemyBB, usBB uint64, moves *[]uint16) {
 }
 
 // Generate queen moves
-func genQueenMoves(queensBB, enemyBB, usBB uint64, moves *[]uint16) {
-	genBishopMoves(queensBB, enemyBB, usBB, moves)
-	genRookMoves(queensBB, enemyBB, usBB, moves)
+func genQueenMoves(board *Board, queensBB, enemyBB, usBB uint64, moves *[]uint16) {
+	genBishopMoves(board, queensBB, enemyBB, usBB, moves)
+	genRookMoves(board, queensBB, enemyBB, usBB, moves)
 }
 
-// Generate king moves
-func genKingMoves(board *Board, enemyColor int, kingBB, usBB uint64, moves *[]uint16) {
-	from := getLSBPos(kingBB)
-	enemyBB := board.PieceBB[enemyColor]
-	kingMoves := KingMoves[from] & ^usBB
+// Generate king moves, given the squares the enemy attacks
+func genKingMoves(from int, enemyBB, usBB, enemyAttacksBB uint64, moves *[]uint16) {
+	kingMoves := KingMoves[from] & ^(usBB | enemyAttacksBB)
 	for kingMoves != 0 {
 		to, toBB := popLSB(&kingMoves)
-		if squareIsAttacked(board, enemyColor, toBB, usBB) {
-			continue
-		}
 		moveType := Quiet
 		if toBB&enemyBB != 0 {
 			moveType = Attack
@@ -307,41 +562,68 @@ func genKingMoves(board *Board, enemyColor int, kingBB, usBB uint64, moves *[]ui
 	}
 }
 
-// Generate castling moves
-func genCastlingMoves(board *Board, enemyColor int, usBB uint64, moves *[]uint16) {
-	allPieces := board.PieceBB[enemyColor] | usBB
+// Generate castling moves, given the squares the enemy attacks
+func genCastlingMoves(board *Board, enemyAttacksBB uint64, moves *[]uint16) {
+	allPieces := board.Occupied
 	if board.WhiteToMove {
-		if board.CastlingRights&WhiteKingside != 0 && allPieces&F1_G1 == 0 &&
-			(!squareIsAttacked(board, enemyColor, setSingleBit(5), usBB) &&
-				!squareIsAttacked(board, enemyColor, setSingleBit(6), usBB)) {
+		if board.CastlingRights&WhiteKingside != 0 && allPieces&F1_G1 == 0 && enemyAttacksBB&F1_G1 == 0 {
 			*moves = append(*moves, MakeMove(4, 6, CastleWKS))
 		}
-		if board.CastlingRights&WhiteQueenside != 0 && allPieces&B1_C1_D1 == 0 &&
-			(!squareIsAttacked(board, enemyColor, setSingleBit(2), usBB) &&
-				!squareIsAttacked(board, enemyColor, setSingleBit(3), usBB)) {
+		if board.CastlingRights&WhiteQueenside != 0 && allPieces&B1_C1_D1 == 0 && enemyAttacksBB&C1_D1 == 0 {
 			*moves = append(*moves, MakeMove(4, 2, CastleWQS))
 		}
 	} else {
-		if board.CastlingRights&BlackKingside != 0 && allPieces&F8_G8 == 0 &&
-			(!squareIsAttacked(board, enemyColor, setSingleBit(61), usBB) &&
-				!squareIsAttacked(board, enemyColor, setSingleBit(62), usBB)) {
+		if board.CastlingRights&BlackKingside != 0 && allPieces&F8_G8 == 0 && enemyAttacksBB&F8_G8 == 0 {
 			*moves = append(*moves, MakeMove(60, 62, CastleBKS))
 		}
-		if board.CastlingRights&BlackQueenside != 0 && allPieces&B8_C8_D8 == 0 &&
-			(!squareIsAttacked(board, enemyColor, setSingleBit(58), usBB) &&
-				!squareIsAttacked(board, enemyColor, setSingleBit(59), usBB)) {
+		if board.CastlingRights&BlackQueenside != 0 && allPieces&B8_C8_D8 == 0 && enemyAttacksBB&C8_D8 == 0 {
 			*moves = append(*moves, MakeMove(60, 58, CastleBQS))
 		}
 	}
 }
 
+// Generate castling moves in Chess960, where the king and rooks can start
+// anywhere on the back rank, but still end up on the same squares as in
+// standard chess. Every square between the king and its destination, and
+// the rook and its destination, has to be empty, except for the king and
+// rook themselves, and none of the squares the king crosses can be attacked.
+// The castling rook is lifted off the board when checking for attacks, since
+// it can be shielding the king's destination from a slider. Castling moves
+// are encoded as the king capturing its own rook, as UCI expects in Chess960.
+func genChess960CastlingMoves(board *Board, usColor, enemyColor int, kingBB uint64, moves *[]uint16) {
+	kingSq := board.KingSq[usColor]
+	firstRight := WhiteKingsideRook
+	if usColor == BlackBB {
+		firstRight = BlackKingsideRook
+	}
+
+	for right := firstRight; right < firstRight+2; right++ {
+		if board.CastlingRights&(WhiteKingside>>right) == 0 {
+			continue
+		}
+
+		rookSq := board.CastlingRookSqs[right]
+		kingTo, rookTo := CastlingKingDestSqs[right], CastlingRookDestSqs[right]
+		castlingPiecesBB := kingBB | setSingleBit(rookSq)
+
+		occupiedBB := board.Occupied & ^castlingPiecesBB
+		if (LinesBewteen[kingSq][kingTo]|LinesBewteen[rookSq][rookTo])&occupiedBB != 0 {
+			continue
+		}
+
+		if LinesBewteen[kingSq][kingTo]&genAttacksBB(board, enemyColor, occupiedBB) == 0 {
+			*moves = append(*moves, MakeMove(kingSq, rookSq, CastleWKS+right))
+		}
+	}
+}
+
 // If the king is in check, then this special check evasion function is called that calculates
 // the few moves the color to move has. The basic algorithm is first to check if the king is in
 // double or single check. If double check, the king has to move. If single check and the checker
 // is a knight, then the only choices are to move the king or capture the knight. Otherwise, then
 // the options are to block, capture, or move the king from the slider piece giving check.
-func genCheckEvasionMoves(board *Board, enemyColor, usColor int, kingBB, checkersBB, notPinnedMask uint64, moves *[]uint16) {
-	kingPos := getLSBPos(kingBB)
+func genCheckEvasionMoves(board *Board, enemyColor, usColor int, kingBB, checkersBB, notPinnedMask, enemyAttacksBB uint64, moves *[]uint16) {
+	kingPos := board.KingSq[usColor]
 	usBB := board.PieceBB[usColor]
 	enemyBB := board.PieceBB[enemyColor]
 
@@ -349,10 +631,10 @@ func genCheckEvasionMoves(board *Board, enemyColor, usColor int, kingBB, checker
 	var pseduolegalPawnMoves []uint16
 	genPawnMoves(board, ourPawns, enemyBB, usBB, &pseduolegalPawnMoves)
 
-	// We need to remove the king from our board when calculating check evasion moves,
-	// so that enemy sliders can "xray" the king and show that they attack the squares
-	// *behind* the king as well, so the king doesn't just slide back still in check.
-	genKingMoves(board, enemyColor, kingBB, usBB & ^kingBB, moves)
+	// The enemy's attacks are computed with our king removed from the board,
+	// so enemy sliders "xray" the king and attack the squares *behind* the
+	// king as well, and the king doesn't just slide back still in check.
+	genKingMoves(kingPos, enemyBB, usBB, enemyAttacksBB, moves)
 
 	if bits.OnesCount64(checkersBB) > 1 {
 		return
@@ -368,7 +650,7 @@ func genCheckEvasionMoves(board *Board, enemyColor, usColor int, kingBB, checker
 			}
 		}
 
-		sqProtectorsBB := attackersOfSquare(board, usColor, checkersBB, enemyBB) & notPinnedMask
+		sqProtectorsBB := attackersOfSquare(board, usColor, checkersBB) & notPinnedMask
 
 		for sqProtectorsBB != 0 {
 			protectorPos, _ := popLSB(&sqProtectorsBB)
@@ -398,7 +680,7 @@ func genCheckEvasionMoves(board *Board, enemyColor, usColor int, kingBB, checker
 
 		for betweenBB != 0 {
 			sqPos, sqBB := popLSB(&betweenBB)
-			ourSqProtectors := attackersOfSquare(board, usColor, sqBB, enemyBB)
+			ourSqProtectors := attackersOfSquare(board, usColor, sqBB)
 			ourSqProtectors &= notPinnedMask
 
 			for ourSqProtectors != 0 {
@@ -428,7 +710,7 @@ func genPinnedPiecesMoves(board *Board, enemyColor, usColor int, kingBB uint64,
 	usBB := board.PieceBB[usColor]
 	pinnersBB := (genIntercardianlMovesBB(kingBB, enemyBB)&(enemyBishops|enemyQueens) |
 		genCardianlMovesBB(kingBB, enemyBB)&(enemyRooks|enemyQueens))
-	kingPos := getLSBPos(kingBB)
+	kingPos := board.KingSq[usColor]
 	for pinnersBB != 0 {
 		pinnerPos, pinnerBB := popLSB(&pinnersBB)
 		possiblyPinnedBB := LinesBewteen[kingPos][pinnerPos] & usBB
@@ -455,11 +737,11 @@ func genPinnedPiecesMoves(board *Board, enemyColor, usColor int, kingBB uint64,
 				genMovesFromBB(pinnedPos, rayBetween, enemyBB, moves)
 			} else if (pinnerType == RookBB || pinnerType == QueenBB) && pinnedType == PawnBB &&
 				directionIsNorthOrSouth(pinnerRayDirection) {
-				pawnPush := BlackPawnPushes[pinnedPos] & ^(enemyBB | usBB)
-				pawnPush |= ((pawnPush & MaskRank[Rank6]) << 8) & ^(enemyBB | usBB)
+				pawnPush := BlackPawnPushes[pinnedPos] & ^board.Occupied
+				pawnPush |= ((pawnPush & MaskRank[Rank6]) << 8) & ^board.Occupied
 				if usColor == WhiteBB {
-					pawnPush = WhitePawnPushes[pinnedPos] & ^(enemyBB | usBB)
-					pawnPush |= ((pawnPush & MaskRank[Rank3]) >> 8) & ^(enemyBB | usBB)
+					pawnPush = WhitePawnPushes[pinnedPos] & ^board.Occupied
+					pawnPush |= ((pawnPush & MaskRank[Rank3]) >> 8) & ^board.Occupied
 				}
 				genMovesFromBB(pinnedPos, pawnPush, 0, moves)
 			} else if (pinnerType == BishopBB || pinnerType == QueenBB) && pinnedType == PawnBB &&
@@ -478,6 +760,23 @@ func genPinnedPiecesMoves(board *Board, enemyColor, usColor int, kingBB uint64,
 					}
 				}
 
+				// The pawn can also capture en passant along the line of the
+				// pin, as long as removing the captured pawn doesn't uncover
+				// an attack on the king along another line.
+				epSq := board.EPSquare
+				if epSq != NoEPSquare && pawnAttacks&rayBetween&setSingleBit(epSq) != 0 {
+					capturePos := epSq + 8
+					if usColor == WhiteBB {
+						capturePos = epSq - 8
+					}
+					board.movePiece(pinnedPos, epSq)
+					board.removePiece(capturePos)
+					if !squareIsAttacked(board, enemyColor, kingBB) {
+						*moves = append(*moves, MakeMove(pinnedPos, epSq, AttackEP))
+					}
+					board.movePiece(epSq, pinnedPos)
+					board.putPiece(PawnBB, enemyColor, capturePos)
+				}
 			}
 		}
 	}
@@ -517,7 +816,7 @@ func directionIsNorthOrSouth(direction Direction) bool {
 // piece on the square of interest, and generating cardinal, intercardinal,
 // and knight rays from the square. If any of these rays interesect with the
 // enemyBB, then that intersection is an attacker.s
-func attackersOfSquare(board *Board, enemyColor int, squareBB, usBB uint64) (attackers uint64) {
+func attackersOfSquare(board *Board, enemyColor int, squareBB uint64) (attackers uint64) {
 	enemyBB := board.PieceBB[enemyColor]
 	enemyBishop := enemyBB & board.PieceBB[BishopBB]
 	enemyRook := enemyBB & board.PieceBB[RookBB]
@@ -527,8 +826,8 @@ func attackersOfSquare(board *Board, enemyColor int, squareBB, usBB uint64) (att
 	enemyPawns := enemyBB & board.PieceBB[PawnBB]
 
 	squarePos := getLSBPos(squareBB)
-	intercardinalRays := genIntercardianlMovesBB(squareBB, enemyBB|usBB)
-	cardinalRaysRays := genCardianlMovesBB(squareBB, enemyBB|usBB)
+	intercardinalRays := genIntercardianlMovesBB(squareBB, board.Occupied)
+	cardinalRaysRays := genCardianlMovesBB(squareBB, board.Occupied)
 
 	attackers |= intercardinalRays & (enemyBishop | enemyQueen)
 	attackers |= cardinalRaysRays & (enemyRook | enemyQueen)
@@ -547,8 +846,7 @@ func attackersOfSquare(board *Board, enemyColor int, squareBB, usBB uint64) (att
 // not the function is being attacked. Thus, this function is more efficent
 // when we only care about whether or not a square is attacked since it can
 // return early.
-func squareIsAttacked(board *Board, enemyColor int, squareBB, usBB uint64) bool {
-	enemyBB := board.PieceBB[enemyColor]
+func squareIsAttacked(board *Board, enemyColor int, squareBB uint64) bool {
 	enemyBishop := board.PieceBB[enemyColor] & board.PieceBB[BishopBB]
 	enemyRook := board.PieceBB[enemyColor] & board.PieceBB[RookBB]
 	enemyQueen := board.PieceBB[enemyColor] & board.PieceBB[QueenBB]
@@ -557,8 +855,8 @@ func squareIsAttacked(board *Board, enemyColor int, squareBB, usBB uint64) bool
 	enemyPawns := board.PieceBB[enemyColor] & board.PieceBB[PawnBB]
 
 	squarePos := getLSBPos(squareBB)
-	intercardinalRays := genIntercardianlMovesBB(squareBB, enemyBB|usBB)
-	cardinalRaysRays := genCardianlMovesBB(squareBB, enemyBB|usBB)
+	intercardinalRays := genIntercardianlMovesBB(squareBB, board.Occupied)
+	cardinalRaysRays := genCardianlMovesBB(squareBB, board.Occupied)
 
 	if intercardinalRays&(enemyBishop|enemyQueen) != 0 {
 		return true
@@ -583,10 +881,29 @@ func squareIsAttacked(board *Board, enemyColor int, squareBB, usBB uint64) bool
 // Given a bitboard with a single bit set at a slider's location,
 // and an occupancy bitboard containing the bits of all white and
 // black pieces, this function calculates all possible moves for the
-// slider in the intercardinal directions. The algorithm used is
-// "Hyperbola Quintessence", created by Gerd Isenberg, and the specfic
-// formula used here was given by Johnathan, from Logic Crazy Chess.
+// slider in the intercardinal directions, by looking them up in the
+// table of bishop moves (see magics.go).
 func genIntercardianlMovesBB(sliderBB, occupiedBB uint64) uint64 {
+	magic := &BishopMagics[getLSBPos(sliderBB)]
+	return BishopMoves[magic.Offset+int(((occupiedBB&magic.Mask)*magic.Magic)>>magic.Shift)]
+}
+
+// Given a bitboard with a single bit set at a slider's location,
+// and an occupancy bitboard containing the bits of all white and
+// black pieces, this function calculates all possible moves for the
+// slider in the cardinal directions, by looking them up in the
+// table of rook moves (see magics.go).
+func genCardianlMovesBB(sliderBB, occupiedBB uint64) uint64 {
+	magic := &RookMagics[getLSBPos(sliderBB)]
+	return RookMoves[magic.Offset+int(((occupiedBB&magic.Mask)*magic.Magic)>>magic.Shift)]
+}
+
+// Calculate the moves of a slider in the intercardinal directions
+// without the magic bitboard tables, which is used to fill them in.
+// The algorithm used is "Hyperbola Quintessence", created by Gerd
+// Isenberg, and the specfic formula used here was given by Johnathan,
+// from Logic Crazy Chess.
+func genHyperbolaIntercardinalMovesBB(sliderBB, occupiedBB uint64) uint64 {
 	sliderPos := getLSBPos(sliderBB)
 	diagonalMask := MaskDiagonal[(sliderPos%8)-(sliderPos/8)+7]
 	antidiagonalMask := MaskAntidiagonal[14-((sliderPos/8)+(sliderPos%8))]
@@ -602,13 +919,9 @@ func genIntercardianlMovesBB(sliderBB, occupiedBB uint64) uint64 {
 	return diagonalMoves | antidiagonalMoves
 }
 
-// Given a bitboard with a single bit set at a slider's location,
-// and an occupancy bitboard containing the bits of all white and
-// black pieces, this function calculates all possible moves for the
-// slider in the cardinal directions. The algorithm used is
-// "Hyperbola Quintessence", created by Gerd Isenberg, and the specfic
-// formula used here was given by Johnathan, from Logic Crazy Chess.
-func genCardianlMovesBB(sliderBB, occupiedBB uint64) uint64 {
+// Calculate the moves of a slider in the cardinal directions without
+// the magic bitboard tables, like genHyperbolaIntercardinalMovesBB.
+func genHyperbolaCardinalMovesBB(sliderBB, occupiedBB uint64) uint64 {
 	sliderPos := getLSBPos(sliderBB)
 	fileMask := MaskFile[sliderPos%8]
 	rankMask := MaskRank[sliderPos/8]
@@ -695,6 +1008,70 @@ func RawPerft(board *Board, depth int, ttable *[TTPerftSize]PerftTTEntry) uint64
 	return perft(board, depth, ttable)
 }
 
+// The leaf nodes of a perft search broken down by the kind of move that
+// reached them, in the same columns published perft results use. Since a
+// capture can also be a promotion, and any move can give check, a leaf can
+// be counted in more than one column.
+type PerftResults struct {
+	Nodes      uint64
+	Captures   uint64
+	EnPassant  uint64
+	Castles    uint64
+	Promotions uint64
+	Checks     uint64
+	Checkmates uint64
+}
+
+// Explore the move tree up to depth like perft, but break the leaf nodes
+// down by the kind of move that reached them. No transposition table is
+// used, since it would have to store every column, so this is slower than
+// perft, but the breakdown makes it much easier to narrow down a bug that
+// only shows up as a wrong node count.
+func PerftDetailed(board *Board, depth int) (results PerftResults) {
+	if depth == 0 {
+		return PerftResults{Nodes: 1}
+	}
+	perftDetailed(board, depth, &results)
+	return results
+}
+
+func perftDetailed(board *Board, depth int, results *PerftResults) {
+	moves := make([]uint16, 0, 220)
+	GenLegalMoves(board, &moves)
+	for _, move := range moves {
+		if depth > 1 {
+			board.DoMove(&move, true)
+			perftDetailed(board, depth-1, results)
+			board.UndoMove(&move)
+			continue
+		}
+
+		_, to, moveType := GetMoveInfo(move)
+		results.Nodes++
+		switch {
+		case moveType == AttackEP:
+			results.Captures++
+			results.EnPassant++
+		case moveType >= CastleWKS && moveType <= CastleBQS:
+			results.Castles++
+		case board.Pieces[to] != NoPiece:
+			results.Captures++
+		}
+		if moveType >= KnightPromotion {
+			results.Promotions++
+		}
+
+		board.DoMove(&move, true)
+		if board.InCheck() {
+			results.Checks++
+			if board.IsCheckmate() {
+				results.Checkmates++
+			}
+		}
+		board.UndoMove(&move)
+	}
+}
+
 // A convient wrapper around perft
 func Perft(board *Board, depth int, ttable *[TTPerftSize]PerftTTEntry) {
 	defer timeit(time.Now())
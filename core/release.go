@@ -0,0 +1,8 @@
+//go:build !debug
+// +build !debug
+
+package core
+
+// In normal builds the debug checks are disabled. Since DebugMode is a
+// constant, the compiler removes any code guarded by it entirely.
+const DebugMode = false
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* This file contains the code to convert moves to and from Standard
+Algebraic Notation (SAN), the notation used in PGN files and by most humans
+(e.g. Nf3, exd5, O-O, e8=Q+). Unlike the long algebraic notation used by the UCI
+protocol, SAN only gives the square a piece moves from when it's needed to
+tell apart two pieces of the same type that can move to the same square,
+so the position the move is played in has to be known to write it.
+*/
+
+// The letters used for each type of piece in SAN, indexed by piece type.
+// Pawns don't get a letter.
+const SANPieceLetters = "PNBRQK"
+
+// Convert a legal move in the current position to SAN, including the
+// check (+) or checkmate (#) suffix.
+func MoveToSAN(board *Board, move uint16) string {
+	from, to, moveType := GetMoveInfo(move)
+	pieceType := GetPieceType(board.Pieces[from])
+
+	var san strings.Builder
+	switch {
+	case moveType == CastleWKS || moveType == CastleBKS:
+		san.WriteString("O-O")
+	case moveType == CastleWQS || moveType == CastleBQS:
+		san.WriteString("O-O-O")
+	case pieceType == PawnBB:
+		if moveType == AttackEP || board.Pieces[to] != NoPiece {
+			san.WriteByte(byte('a' + from%8))
+			san.WriteByte('x')
+		}
+		san.WriteString(PosToCoordinate(to))
+		if moveType >= KnightPromotion {
+			san.WriteByte('=')
+			san.WriteByte("NBRQ"[moveType-KnightPromotion])
+		}
+	default:
+		san.WriteByte(SANPieceLetters[pieceType])
+		san.WriteString(disambiguateMove(board, move))
+		if board.Pieces[to] != NoPiece {
+			san.WriteByte('x')
+		}
+		san.WriteString(PosToCoordinate(to))
+	}
+
+	board.DoMove(&move, true)
+	if board.IsCheckmate() {
+		san.WriteByte('#')
+	} else if board.InCheck() {
+		san.WriteByte('+')
+	}
+	board.UndoMove(&move)
+	return san.String()
+}
+
+// Get the part of a piece move's SAN that tells it apart from the moves of
+// other pieces of the same type to the same square. The file the piece
+// moves from is used if that's enough, then the rank, and then both.
+func disambiguateMove(board *Board, move uint16) string {
+	from, to, _ := GetMoveInfo(move)
+	pieceType := GetPieceType(board.Pieces[from])
+
+	var moves []uint16
+	GenLegalMoves(board, &moves)
+
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, otherMove := range moves {
+		otherFrom, otherTo, _ := GetMoveInfo(otherMove)
+		if otherTo != to || otherFrom == from || GetPieceType(board.Pieces[otherFrom]) != pieceType {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || otherFrom%8 == from%8
+		sameRank = sameRank || otherFrom/8 == from/8
+	}
+
+	coordinate := PosToCoordinate(from)
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return coordinate[:1]
+	case !sameRank:
+		return coordinate[1:]
+	default:
+		return coordinate
+	}
+}
+
+// Parse a move given in SAN in the current position. The move's source
+// square is found by matching the piece, destination square, promotion,
+// and any disambiguation given against the legal moves. An error is
+// returned if the SAN is malformed, or doesn't match exactly one legal move.
+func SANToMove(board *Board, san string) (uint16, error) {
+	// Check and checkmate suffixes, annotations, and the "e.p." some
+	// writers add to en passant captures aren't needed to find the move.
+	text := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	text = strings.TrimSuffix(text, "e.p.")
+	text = strings.TrimSpace(text)
+
+	var moves []uint16
+	GenLegalMoves(board, &moves)
+
+	if text == "O-O" || text == "0-0" || text == "O-O-O" || text == "0-0-0" {
+		queenside := len(text) == 5
+		for _, move := range moves {
+			moveType := getMoveType(move)
+			if (!queenside && (moveType == CastleWKS || moveType == CastleBKS)) ||
+				(queenside && (moveType == CastleWQS || moveType == CastleBQS)) {
+				return move, nil
+			}
+		}
+		return NullMove, fmt.Errorf("invalid san \"%v\": castling isn't legal", san)
+	}
+
+	pieceType := PawnBB
+	if len(text) > 0 && strings.IndexByte("NBRQK", text[0]) != -1 {
+		pieceType = strings.IndexByte(SANPieceLetters, text[0])
+		text = text[1:]
+	}
+
+	// Promotions can be written with or without an equals sign (e8=Q or e8Q).
+	promotionType := -1
+	if len(text) > 0 && strings.IndexByte("NBRQ", text[len(text)-1]) != -1 {
+		promotionType = strings.IndexByte(SANPieceLetters, text[len(text)-1])
+		text = strings.TrimSuffix(text[:len(text)-1], "=")
+	}
+
+	if len(text) < 2 || !isSANSquare(text[len(text)-2:]) {
+		return NullMove, fmt.Errorf("invalid san \"%v\": no destination square", san)
+	}
+	to := CoordinateToPos(text[len(text)-2:])
+
+	// Whatever is left over is the file and/or rank of the source square,
+	// and possibly an "x" to mark a capture.
+	fromFile, fromRank := -1, -1
+	for _, char := range strings.Replace(text[:len(text)-2], "x", "", 1) {
+		switch {
+		case char >= 'a' && char <= 'h':
+			fromFile = int(char - 'a')
+		case char >= '1' && char <= '8':
+			fromRank = int(char - '1')
+		default:
+			return NullMove, fmt.Errorf("invalid san \"%v\": unknown character '%c'", san, char)
+		}
+	}
+
+	matchingMove, matches := NullMove, 0
+	for _, move := range moves {
+		from, moveTo, moveType := GetMoveInfo(move)
+		if moveTo != to || GetPieceType(board.Pieces[from]) != pieceType ||
+			moveType == CastleWKS || moveType == CastleWQS || moveType == CastleBKS || moveType == CastleBQS {
+			continue
+		}
+		if (fromFile != -1 && from%8 != fromFile) || (fromRank != -1 && from/8 != fromRank) {
+			continue
+		}
+
+		movePromotionType := -1
+		if moveType >= KnightPromotion {
+			movePromotionType = KnightBB + int(moveType-KnightPromotion)
+		}
+		if movePromotionType != promotionType {
+			continue
+		}
+		matchingMove, matches = move, matches+1
+	}
+
+	switch matches {
+	case 0:
+		return NullMove, fmt.Errorf("invalid san \"%v\": no legal move matches it", san)
+	case 1:
+		return matchingMove, nil
+	default:
+		return NullMove, fmt.Errorf("invalid san \"%v\": it's ambiguous", san)
+	}
+}
+
+// Determine if a string is the coordinate of a square, such as "e4".
+func isSANSquare(coordinate string) bool {
+	return len(coordinate) == 2 && coordinate[0] >= 'a' && coordinate[0] <= 'h' &&
+		coordinate[1] >= '1' && coordinate[1] <= '8'
+}
@@ -2,7 +2,11 @@ package core
 
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 const (
@@ -12,12 +16,21 @@ const (
 	// Max quiesence search depth of engine
 	QuiesenceSearchDepth = 3
 
+	// The maximum number of plies from the root the search can
+	// reach. Mate scores are stored as the distance in plies from
+	// the root, so any score within MaxPly of PosInf or NegInf is
+	// a mate score.
+	MaxPly = 100
+
 	// Represents a null best move, which should
 	// never actually be returned from the search
 	NullMove uint16 = 0
 
-	// The size of the transpositon table
-	TTSize = 0x100000 * 16
+	// The default, minimum, and maximum sizes of the transposition
+	// table, in megabytes
+	DefaultTTSizeMB = 256
+	MinTTSizeMB     = 1
+	MaxTTSizeMB     = 4096
 
 	// Flags to indicate what kind of value a transposition table entry has
 	AlphaFlag uint8 = iota
@@ -30,9 +43,9 @@ const (
 	// A flag representing a null Zobrist hash value
 	NullHash uint64 = 0
 
-	// Bonus given to moves that are captures. Used in move ordering
-	// to ensure that even a capture by the least valuable victim and the
-	// most valuable attacker is still scored above other moves.
+	// Bonus given to captures which don't lose material. Used in move
+	// ordering to ensure that even an equal exchange is still scored
+	// above other moves.
 	CaptureBonus = 1000
 
 	// Bonuses given to the two killer moves at any ply. Used in
@@ -40,288 +53,1326 @@ const (
 	FirstKillerBonus  = 150
 	SecondKillerBonus = 100
 
+	// Bonus given to the countermove of the move played before, which is
+	// ordered after the killer moves, but before the other quiet moves.
+	CounterMoveBonus = 50
+
+	// Bonus given to the best move stored in the transposition table
+	// for a position, so it's always searched first.
+	TTMoveBonus = 10000
+
+	// The half-width of the aspiration window centered around the
+	// score of the previous iteration, and the depth at which
+	// aspiration windows start being used.
+	AspirationWindow   = 25
+	AspirationMinDepth = 4
+
+	// The safety margin used for delta pruning in the quiescence search.
+	// A capture is skipped if it can't raise the score to alpha even
+	// after winning this much on top of the captured piece. Promotions
+	// gain the value of the promoted piece as well, so they get an extra
+	// margin.
+	DeltaMargin          = 200
+	PromotionDeltaMargin = QueenValue
+
+	// Late move reductions are only applied to moves at or after this
+	// index in the move list, at nodes with at least this much depth
+	// left to search.
+	LMRMinMoveIndex = 4
+	LMRMinDepth     = 3
+
+	// Futility pruning is done at nodes with at most this much depth left
+	// to search, where a quiet move is skipped if the static evaluation
+	// is so far below alpha that even gaining this margin for each ply
+	// left wouldn't raise it to alpha.
+	FutilityMaxDepth = 2
+	FutilityMargin   = 200
+
+	// Reverse futility pruning is done at nodes with at most this much
+	// depth left to search, where the node fails high right away if the
+	// static evaluation is above beta by at least this margin for each
+	// ply left.
+	ReverseFutilityMaxDepth = 3
+	ReverseFutilityMargin   = 120
+
+	// How often, in nodes, the time is checked during a search
+	// with a time limit.
+	TimeCheckInterval = 1024
+
+	// How often a finished infinite or pondering search checks whether
+	// the GUI wants its best move yet.
+	StopPollInterval = 5 * time.Millisecond
+
+	// The maximum score a move can have in the history table. Scores
+	// are capped at this value so they can't grow without bound over
+	// the course of a long game.
+	MaxHistoryScore = 10000
+
+	// The default and maximum number of lines the search can be
+	// asked to find with the MultiPV option.
+	DefaultMultiPV = 1
+	MaxMultiPV     = 500
+
+	// The default and maximum contempt, in centipawns, the Contempt
+	// option can be set to.
+	DefaultContempt = 0
+	MaxContempt     = 200
+
 	// Number of book moves the engine will use
 	BookMovesDepth = 5
 
-	// Time, in milliseconds, at and under which Blunder
-	// begins limiting its search time to a specfic threshold
-	// to try not to lose on time.
-	TimeThreshHoldForBulletPlay = 1000 * 180
-
-	// Time per move under bullet circumstances (~2 min of time). This can
-	// be used for bullet chess, but more generally, it's used to try to
-	// prevent Blunder loosing games on time. Throughout the game Blunder
-	// is allowed to think as deeply as it wants, but under a minute of time
-	// left we have to be more judicially, and each move gets no more than ~3
-	// seconds.
-	TimePerMoveBullet = 2000 // in milliseconds
+	// The capacity of the buffer of moves kept for each ply, which is
+	// more than the most legal moves any position can have (218).
+	MoveBufferSize = 256
 )
 
-// A transpositon table entry
+// The number of plies a late move is reduced by, indexed by the depth
+// left to search and the move's index in the move list. Moves searched
+// later, and at greater depths, are reduced more, since they're less
+// likely to be any good the better ordered the moves are.
+var LateMoveReductions [MaxPly + 1][64]int
+
+// The scores used to order promotions, indexed by the type of the piece
+// captured and then by the type of the piece promoted to. Each score is the
+// value of the piece promoted to plus the value of the piece captured. An
+// empty square reads as a pawn, so a promotion which doesn't capture is
+// scored as capturing a pawn.
+var PromotionScores [6][6]int
+
+func init() {
+	for capturedType := PawnBB; capturedType <= KingBB; capturedType++ {
+		for promotionType := KnightBB; promotionType <= QueenBB; promotionType++ {
+			PromotionScores[capturedType][promotionType] = getPieceValue(promotionType) + getPieceValue(capturedType)
+		}
+	}
+
+	for depth := LMRMinDepth; depth <= MaxPly; depth++ {
+		for moveIndex := LMRMinMoveIndex; moveIndex < 64; moveIndex++ {
+			LateMoveReductions[depth][moveIndex] = 1
+			if depth >= 6 && moveIndex >= 12 {
+				LateMoveReductions[depth][moveIndex] = 2
+			}
+		}
+	}
+}
+
+// A transpositon table entry. Since the table is shared by every thread
+// searching (see smp.go), an entry is stored as two 64-bit words, each of
+// which is read and written atomically. Data packs the entry's depth, value,
+// flag, generation, and best move together, and Key is the position's hash xor'd with Data, so an
+// entry torn by two threads writing it at once won't match any position.
 type TTEntry struct {
-	Hash     uint64
-	Depth    int
-	Value    int
-	Flag     uint8
-	BestMove uint16
+	Key  uint64
+	Data uint64
 }
 
 // This object provides a conveient container for
 // holding the state needed during a search, mainly
 // the board, and transposition table.
 type Searcher struct {
-	Board  Board
-	ttable [TTSize]TTEntry
+	Board Board
 
-	// Store the killer moves of a play (i.e. the moves that caused
-	// a beta cutoff)
-	killerMoves [SearchDepth][2]uint16
+	// The transposition table. Its length is always a power of two, and
+	// it's sized at runtime, since the GUI can ask for a different size.
+	ttable []TTEntry
 
-	// Store moves that caused alpha to increase irrespective of the
-	// position in which they were played, and order those higher.
+	// The generation of the current search, which is incremented every
+	// search and stored in the entries it makes in the transposition
+	// table, so entries left over from earlier searches can be replaced.
+	generation uint8
+
+	// Store the killer moves of a ply (i.e. the moves that caused
+	// a beta cutoff), indexed by the distance from the root, since
+	// killers from nodes at the same ply are the most likely to be
+	// good in each other's positions. The quiescence search doesn't
+	// use them, so there's only room for the plies of the main search.
+	killerMoves [MaxPly + 1][2]uint16
+
+	// Store how often quiet moves caused a beta cutoff, irrespective
+	// of the position in which they were played, and order those that
+	// did more often higher. Quiet moves searched before the move that
+	// caused a cutoff are penalized, so scores can be negative.
 	searchHistory [64][64]int
 
-	// Variables to store information useful for debugging the engine
-	NodesExplored uint64
-	TTHits        uint64
+	// Store the quiet move that last caused a beta cutoff in reply to each
+	// move, indexed by the from and to squares of the move replied to.
+	// Good replies to a move tend to be good regardless of the position.
+	counterMoves [64][64]uint16
+
+	// Variables to store information useful for debugging the engine.
+	// NodesExplored counts every node searched by the current iteration,
+	// and QNodesExplored counts the subset of those the quiescence search
+	// recursed into, past the horizon of the main search. TTProbes counts
+	// how many times the current search probed the transposition table,
+	// and TTHits how many of those probes found an entry for the position.
+	NodesExplored  uint64
+	QNodesExplored uint64
+	TTProbes       uint64
+	TTHits         uint64
+
+	// Whether the GUI has turned on debug mode, in which case extra
+	// statistics about each search are reported along with the usual
+	// info lines.
+	Debug bool
 
 	// A flag set by the GUI if we're told to stop searching, according
-	// to the UCI protocol
-	StopSearch bool
+	// to the UCI protocol. It's set from a different goroutine than the
+	// one searching, so it's only ever accessed atomically (see Stop).
+	stopSearch uint32
 
 	// Number of book moves left to use before we start searching for our
 	// own moves.
 	BookMovesLeft int
+
+	// Whether the scores reported to the GUI should be from white's
+	// point of view, rather than the side to move's. This only affects
+	// the info lines sent to the GUI, not the search itself.
+	WhitePOVScore bool
+
+	// The number of best lines to search for and report to the GUI,
+	// for analysis. Only the first line's move is ever played.
+	MultiPV int
+
+	// How much the engine dislikes draws, in centipawns. A draw is scored
+	// as this much worse than an equal position for the side that was to
+	// move at the root, and this much better for its opponent, so the
+	// engine plays on when it's positive, and a negative contempt makes
+	// it seek draws.
+	Contempt int
+
+	// The number of threads to search with, and the searchers used by the
+	// threads helping this one. Each helper has its own board and search
+	// state, but shares the transposition table.
+	Threads     int
+	helpers     []*Searcher
+	helperGroup *sync.WaitGroup
+
+	// How many iterations a helper searcher skips, so the helpers
+	// search at staggered depths.
+	stagger int
+
+	// A triangular table used to collect the principal variation. The
+	// line found from the node at each ply is stored in the row for
+	// that ply, starting at the ply's own index, and ends before the
+	// index stored in pvLength.
+	pvTable  [MaxPly + 1][MaxPly + 1]uint16
+	pvLength [MaxPly + 1]int
+
+	// A buffer for the moves generated at each ply, reused by every node
+	// at that ply, so the search doesn't allocate a new list of moves at
+	// every node. The quiescence search can go a few plies past MaxPly.
+	moveBuffers [MaxPly + QuiesenceSearchDepth + 1][]uint16
+
+	// A buffer for the scores of the moves at each ply, used for ordering
+	// them, and reused in the same way as the buffers of moves.
+	moveScoreBuffers [MaxPly + QuiesenceSearchDepth + 1][]int
+
+	// A buffer for the squares attacked in the position at each ply,
+	// reused in the same way, and computed once per node, since both the
+	// move generator and the evaluation need them.
+	attackBuffers [MaxPly + QuiesenceSearchDepth + 1]attackInfo
+
+	// Whether or not the progress of the current search should be
+	// reported to the GUI using UCI info lines.
+	reportInfo bool
+
+	// The depth of the current iteration of iterative deepening.
+	iterationDepth int
+
+	// The limits placed on the current search, when it started, and the
+	// number of nodes searched by the iterations already finished. If a
+	// limit is reached partway through an iteration, aborted is set and
+	// the unfinished iteration is thrown away. prevQNodes is the part of
+	// prevNodes searched by the quiescence search.
+	limits     SearchLimits
+	startTime  time.Time
+	prevNodes  uint64
+	prevQNodes uint64
+	aborted    bool
+
+	// Whether the GUI has told us to ponder, and so ignore the time limits
+	// until it tells us the opponent played the move we're pondering on.
+	// It's only ever accessed atomically. ponderSearch is whether the
+	// current search started out pondering and hasn't noticed the ponder
+	// hit yet, and is only used by the goroutine running the search.
+	pondering    uint32
+	ponderSearch bool
+
+	// The number of nodes searched so far by the current search, which is
+	// updated every so often so other threads can read it while the search
+	// is running. It's only ever accessed atomically.
+	sharedNodes uint64
+
+	// The soft and hard time limits of the current search, in
+	// milliseconds (see computeTimeBudget).
+	softTimeLimit int64
+	hardTimeLimit int64
+
+	// The root moves left out of the current search, since they start
+	// lines already found when searching for multiple lines, and the
+	// principal variation of the best line of the last finished iteration.
+	excludedRootMoves []uint16
+	bestPV            []uint16
 }
 
-// Initalize the searcher
+// Initalize the searcher for a new game, clearing the transposition table
+// and the move ordering heuristics. None of these are cleared between the
+// moves of a game, so each search can reuse what the earlier ones found.
 func (searcher *Searcher) Init() {
-	searcher.ttable = [TTSize]TTEntry{}
+	if searcher.ttable == nil {
+		searcher.ResizeTT(DefaultTTSizeMB)
+	}
+	for index := range searcher.ttable {
+		searcher.ttable[index] = TTEntry{}
+	}
+	searcher.killerMoves = [MaxPly + 1][2]uint16{}
+	searcher.searchHistory = [64][64]int{}
+	searcher.counterMoves = [64][64]uint16{}
+	searcher.helpers = nil
 	searcher.BookMovesLeft = BookMovesDepth
 }
 
+// Resize the transposition table to hold as many entries as will fit in
+// the given number of megabytes, rounded down to a power of two. Any
+// entries already in the table are discarded.
+func (searcher *Searcher) ResizeTT(sizeInMB int) {
+	sizeInMB = max(MinTTSizeMB, min(sizeInMB, MaxTTSizeMB))
+	maxEntries := uint64(sizeInMB) * 1024 * 1024 / uint64(unsafe.Sizeof(TTEntry{}))
+
+	entries := uint64(1)
+	for entries*2 <= maxEntries {
+		entries *= 2
+	}
+	searcher.ttable = make([]TTEntry, entries)
+}
+
 // Load a fen string into the searcher
-func (seacher *Searcher) LoadFEN(fen string) {
-	seacher.Board.LoadFEN(fen)
+func (seacher *Searcher) LoadFEN(fen string) error {
+	return seacher.Board.LoadFEN(fen)
+}
+
+// The limits the GUI can place on a search
+type SearchLimits struct {
+	// The time left on our clock and our increment, in milliseconds, and
+	// the number of moves left until the next time control. If TimeLeft
+	// is zero, there's no clock, and if MovesToGo is zero, it's estimated.
+	TimeLeft  int64
+	Increment int64
+	MovesToGo int
+
+	// If non-zero, the search is looking for a forced mate in
+	// at most this many moves
+	MateIn int
+
+	// If non-zero, the maximum depth to search to, the maximum number
+	// of nodes to search, and the exact time in milliseconds to spend
+	// searching.
+	Depth    int
+	Nodes    uint64
+	MoveTime int64
+
+	// If set, the search doesn't stop until the GUI tells it to, and no best
+	// move is given before then, even if the search finishes early.
+	Infinite bool
+}
+
+// Get the best move to play via iterative deepening, reporting the
+// progress of the search to the GUI as it goes. If the search is
+// looking for a mate, then it searches deep enough to find a mate
+// in the requested number of moves, and stops as soon as one is found.
+func (searcher *Searcher) Search(limits SearchLimits) uint16 {
+	searcher.reportInfo = true
+	searcher.generation++
+	bestMove, bestScore := searcher.iterativeDeepening(getMaxDepth(limits), limits)
+	if limits.MateIn > 0 && !isMateWithin(bestScore, limits.MateIn) {
+		fmt.Printf("info string no mate in %d found\n", limits.MateIn)
+	}
+	return bestMove
+}
+
+// Search the current position via iterative deepening up to the given
+// depth without printing anything, and return the best move found, its
+// score, and the principal variation. This makes it easy to use the
+// engine programmatically, such as for self-play, test suites, or tuning.
+func (searcher *Searcher) SearchToDepth(depth int) (uint16, int, []uint16) {
+	return searcher.SearchQuietly(SearchLimits{Depth: depth})
 }
 
-// Get the best move to play via iterative deepening
-func (searcher *Searcher) Search(timeLeft int64) uint16 {
+// Search the current position within the given limits without printing
+// anything, and return the best move found, its score, and the principal
+// variation, like SearchToDepth.
+func (searcher *Searcher) SearchQuietly(limits SearchLimits) (uint16, int, []uint16) {
+	searcher.reportInfo = false
+	searcher.generation++
+	bestMove, bestScore := searcher.iterativeDeepening(getMaxDepth(limits), limits)
+
+	return bestMove, bestScore, searcher.bestPV
+}
+
+// Get the depth iterative deepening should search up to within the given
+// limits. Searches with a node or time limit go as deep as they can before
+// the limit is reached, unless they're also given a depth limit.
+func getMaxDepth(limits SearchLimits) int {
+	maxDepth := SearchDepth
+	if limits.MateIn > 0 {
+		maxDepth = min(limits.MateIn*2-1, MaxPly)
+	}
+	if limits.Nodes > 0 || limits.MoveTime > 0 || limits.TimeLeft > 0 || limits.Infinite {
+		maxDepth = MaxPly
+	}
+	if limits.Depth > 0 {
+		maxDepth = min(limits.Depth, MaxPly)
+	}
+	return maxDepth
+}
+
+// The iterative deepening loop shared by Search and SearchToDepth. Each
+// iteration is reported to the GUI if the searcher was asked to do so.
+func (searcher *Searcher) iterativeDeepening(maxDepth int, limits SearchLimits) (uint16, int) {
 	bestMove, bestScore := NullMove, NegInf
-	movesToMate := 0
-	var totalSearchTime int64 = 0
+	searcher.ageHistory()
+
+	searcher.limits = limits
+	searcher.startTime = time.Now()
+	searcher.prevNodes = 0
+	searcher.prevQNodes = 0
+	searcher.TTProbes = 0
+	searcher.TTHits = 0
+	atomic.StoreUint64(&searcher.sharedNodes, 0)
+	searcher.aborted = false
+	searcher.softTimeLimit, searcher.hardTimeLimit = computeTimeBudget(limits, searcher.Board.Phase())
+	searcher.ponderSearch = atomic.LoadUint32(&searcher.pondering) == 1
+	searcher.bestPV = nil
+	defer searcher.waitForStop()
+
+	// There can't be more lines than there are legal moves, and the
+	// score of each line from the last iteration is kept, to center the
+	// aspiration window of the next one around.
+	var rootMoves []uint16
+	GenLegalMoves(&searcher.Board, &rootMoves)
 
-	for depth := 1; depth <= SearchDepth; depth++ {
-		if searcher.StopSearch {
-			searcher.StopSearch = false
+	// With no legal moves, the game is already over, by checkmate or
+	// stalemate, so there's nothing to search, and no move to return.
+	if len(rootMoves) == 0 {
+		if searcher.Board.InCheck() {
+			return NullMove, NegInf
+		}
+		return NullMove, searcher.drawValue(0)
+	}
+	numLines := max(1, min(searcher.MultiPV, len(rootMoves)))
+	lineScores := make([]int, numLines)
+	linePVs := make([][]uint16, numLines)
+	for line := range lineScores {
+		lineScores[line] = NegInf
+	}
+
+	// Helpers left over from an earlier search with more threads are
+	// dropped, so their nodes aren't counted as part of this one.
+	if searcher.Threads > 1 {
+		searcher.startHelpers()
+		defer searcher.stopHelpers()
+	} else {
+		searcher.helpers = searcher.helpers[:0]
+	}
+
+	for depth := 1 + searcher.stagger; depth <= maxDepth; depth++ {
+		// The first iteration is always finished, so there's a move to play.
+		if depth > 1 && searcher.stopRequested() {
 			break
 		}
 
-		// Record the time the search took and report it to the GUI
-		start := time.Now()
-		bestMove, bestScore = searcher.rootNegamax(depth)
-		timeTaken := int64(time.Since(start) / time.Millisecond)
-		totalSearchTime += timeTaken
-		// If we're under a time crunch, break early when we've used up all of the time
-		// alloted for each search.
-		if timeLeft <= TimeThreshHoldForBulletPlay && totalSearchTime >= TimePerMoveBullet {
+		// Reset the node counters before the next search
+		searcher.NodesExplored = 0
+		searcher.QNodesExplored = 0
+
+		// Search for each line in turn, leaving the moves starting the
+		// lines already found out of the search for the next one.
+		var move uint16
+		searcher.excludedRootMoves = searcher.excludedRootMoves[:0]
+		for line := 0; line < numLines && !searcher.aborted; line++ {
+			bestLineMove, score := searcher.aspirationSearch(depth, lineScores[line])
+			if line == 0 {
+				move = bestLineMove
+			}
+			lineScores[line] = score
+			linePVs[line] = searcher.getPV()
+			searcher.excludedRootMoves = append(searcher.excludedRootMoves, bestLineMove)
+		}
+		searcher.prevQNodes += searcher.QNodesExplored
+		searcher.prevNodes += searcher.NodesExplored
+		atomic.StoreUint64(&searcher.sharedNodes, searcher.prevNodes)
+
+		// If the search was stopped partway through this iteration, its
+		// results can't be trusted, so use the last finished iteration's.
+		if searcher.aborted {
 			break
 		}
+		bestMove, bestScore = move, lineScores[0]
+		searcher.bestPV = linePVs[0]
 
-		if bestScore > (PosInf-SearchDepth) && bestScore <= PosInf {
-			// If we're getting a huge number for the score, we're mating,
-			// and shoud return mate in however many moves down we found it.
-			movesToMate = (PosInf - bestScore) / 2
-		} else if bestScore < (NegInf+SearchDepth) && bestScore >= NegInf {
-			// Otherwise if we get a huge negative number, we're getting mated
-			// soon and should report the score as negative.
-			movesToMate = (NegInf - bestScore) / 2
+		if searcher.reportInfo {
+			for line := 0; line < numLines; line++ {
+				searcher.reportLine(depth, line+1, lineScores[line], linePVs[line])
+			}
 		}
+		// If we're looking for a mate and found one short enough,
+		// there's no need to search any deeper.
+		if limits.MateIn > 0 && isMateWithin(bestScore, limits.MateIn) {
+			break
+		}
+
+		// Don't start another iteration if we're already out of nodes,
+		// or we've used up the time we wanted to spend on this move.
+		if limits.Nodes > 0 && searcher.prevNodes >= limits.Nodes {
+			break
+		}
+		if searcher.softTimeLimit > 0 && !searcher.stillPondering() && searcher.elapsedTime() >= searcher.softTimeLimit {
+			break
+		}
+	}
+
+	if searcher.reportInfo && searcher.Debug {
+		fmt.Printf("info string qnodes %d ttprobes %d tthits %d\n", searcher.prevQNodes, searcher.TTProbes, searcher.TTHits)
+	}
+	return bestMove, bestScore
+}
+
+// Report a line found by an iteration of the search to the GUI. The rank
+// of the line is only included when searching for more than one line.
+// The time and nodes reported are for the whole search so far, across
+// every thread.
+func (searcher *Searcher) reportLine(depth, rank, score int, pv []uint16) {
+	// Flip the sign of the score if the GUI wants it from white's
+	// point of view and it's black to move.
+	povSign := 1
+	if searcher.WhitePOVScore && !searcher.Board.WhiteToMove {
+		povSign = -1
+	}
+
+	multiPV := ""
+	if searcher.MultiPV > 1 {
+		multiPV = fmt.Sprintf(" multipv %d", rank)
+	}
+
+	// Report the speed of the search in nodes per second, and how full
+	// the transposition table is in permille. The time taken can be zero
+	// for very shallow searches, so it's rounded up to a millisecond.
+	timeTaken := searcher.elapsedTime()
+	nodes := searcher.totalNodes()
+	nps := nodes * 1000 / uint64(max(int(timeTaken), 1))
+	stats := fmt.Sprintf("time %d nodes %d nps %d hashfull %d", timeTaken, nodes, nps, searcher.hashfull())
+
+	// If the score is a mate score, let the GUI how many full moves until the mate
+	if movesToMate := getMovesToMate(score); movesToMate != 0 {
+		fmt.Printf("info depth %d%v score mate %d %v pv %v\n", depth, multiPV, movesToMate*povSign, stats, pvToString(pv))
+	} else {
+		fmt.Printf("info depth %d%v score cp %d %v pv %v\n", depth, multiPV, score*povSign, stats, pvToString(pv))
+	}
+}
 
-		// If the score is a mate score, let the GUI how many full moves until the mate
-		if movesToMate != 0 {
-			fmt.Printf("info depth %d score mate %d time %d nodes %d\n", depth, movesToMate, timeTaken, searcher.NodesExplored)
+// Search the root position to the given depth, using a narrow window
+// around the score found by the previous iteration, since the score
+// usually changes little from one iteration to the next. If the score
+// falls outside of the window, the search is repeated with the failing
+// side of the window widened. Mate scores can change a lot between
+// iterations, so the full window is used when the last score was a mate.
+func (searcher *Searcher) aspirationSearch(depth, prevScore int) (uint16, int) {
+	alpha, beta := NegInf, PosInf-1
+	if depth >= AspirationMinDepth && getMovesToMate(prevScore) == 0 {
+		alpha, beta = prevScore-AspirationWindow, prevScore+AspirationWindow
+	}
+
+	for {
+		bestMove, bestScore := searcher.rootNegamax(depth, alpha, beta)
+		if searcher.aborted {
+			return bestMove, bestScore
+		}
+		if bestScore <= alpha && alpha != NegInf {
+			alpha = NegInf
+		} else if bestScore >= beta && beta != PosInf-1 {
+			beta = PosInf - 1
 		} else {
-			fmt.Printf("info depth %d score cp %d time %d nodes %d\n", depth, bestScore, timeTaken, searcher.NodesExplored)
+			return bestMove, bestScore
 		}
-		// Reset the node counter before the next search
-		searcher.NodesExplored = 0
 	}
-	return bestMove
+}
+
+// Check whether the search has to be stopped partway through an iteration,
+// because the GUI told us to stop, or the node or hard time limit was
+// reached. The first iteration is always finished, so there's a move to play.
+func (searcher *Searcher) checkAbort() bool {
+	if searcher.aborted || searcher.iterationDepth == 1 {
+		return searcher.aborted
+	}
+
+	limits := searcher.limits
+	nodes := searcher.prevNodes + searcher.NodesExplored
+	if nodes%TimeCheckInterval == 0 {
+		atomic.StoreUint64(&searcher.sharedNodes, nodes)
+	}
+	if searcher.stopRequested() || (limits.Nodes > 0 && nodes >= limits.Nodes) {
+		searcher.aborted = true
+	} else if searcher.hardTimeLimit > 0 && nodes%TimeCheckInterval == 0 &&
+		!searcher.stillPondering() && searcher.elapsedTime() >= searcher.hardTimeLimit {
+		searcher.aborted = true
+	}
+	return searcher.aborted
+}
+
+// Tell the next search whether to ponder. Like ClearStop, this should be
+// done before starting the search, from the goroutine that would send the
+// ponder hit, so the ponder hit can't be lost by arriving too early.
+func (searcher *Searcher) SetPondering(pondering bool) {
+	var value uint32
+	if pondering {
+		value = 1
+	}
+	atomic.StoreUint32(&searcher.pondering, value)
+}
+
+// Tell a pondering search that the opponent played the move it's pondering
+// on, so it should carry on as a normal search within its time limits.
+func (searcher *Searcher) PonderHit() {
+	searcher.SetPondering(false)
+}
+
+// Check whether the current search is still pondering. Once it notices the
+// ponder hit, its clock is restarted, since our time only started running
+// once the opponent played their move.
+func (searcher *Searcher) stillPondering() bool {
+	if !searcher.ponderSearch {
+		return false
+	}
+	if atomic.LoadUint32(&searcher.pondering) == 1 {
+		return true
+	}
+	searcher.ponderSearch = false
+	searcher.startTime = time.Now()
+	return false
+}
+
+// Once a search is over, wait until the GUI wants its best move. The GUI
+// doesn't expect one from an infinite search until it tells us to stop,
+// or from a pondering search until the ponder hit, even if the search
+// finished early. The request to stop is cleared once it's been seen, so it
+// doesn't linger and stop the next search.
+func (searcher *Searcher) waitForStop() {
+	for !searcher.stopRequested() && (searcher.limits.Infinite || searcher.stillPondering()) {
+		time.Sleep(StopPollInterval)
+	}
+	searcher.ClearStop()
+}
+
+// Get the move the opponent is expected to reply to the best move of the
+// last search with, which is the second move of its principal variation,
+// or a null move if the principal variation is too short. This is the move
+// to ponder on.
+func (searcher *Searcher) PonderMove() uint16 {
+	if len(searcher.bestPV) < 2 {
+		return NullMove
+	}
+	return searcher.bestPV[1]
+}
+
+// Get the number of nodes searched by the last search, over all of its
+// iterations and every thread, unlike NodesExplored, which only counts
+// the last iteration of the main thread.
+func (searcher *Searcher) TotalNodesExplored() uint64 {
+	return searcher.totalNodes()
+}
+
+// Get the number of nodes searched by the last search by each thread,
+// starting with the main thread, over all of their iterations.
+func (searcher *Searcher) ThreadNodesExplored() []uint64 {
+	nodes := []uint64{searcher.prevNodes}
+	for _, helper := range searcher.helpers {
+		nodes = append(nodes, atomic.LoadUint64(&helper.sharedNodes))
+	}
+	return nodes
+}
+
+// Get the number of nodes searched by the quiescence search during the
+// last search, by the main thread, over all of its iterations.
+func (searcher *Searcher) TotalQNodesExplored() uint64 {
+	return searcher.prevQNodes
+}
+
+// Tell the current search to stop as soon as it can. This is safe to call
+// from a different goroutine than the one running the search.
+func (searcher *Searcher) Stop() {
+	atomic.StoreUint32(&searcher.stopSearch, 1)
+}
+
+// Clear any request to stop searching. The GUI can tell us to stop after
+// a search has already finished, so this should be done before starting a
+// search, from the goroutine that would tell it to stop, so the request
+// can't stop the next search, and a request made right after the search
+// starts isn't lost.
+func (searcher *Searcher) ClearStop() {
+	atomic.StoreUint32(&searcher.stopSearch, 0)
+}
+
+// Determine if the search has been told to stop.
+func (searcher *Searcher) stopRequested() bool {
+	return atomic.LoadUint32(&searcher.stopSearch) == 1
+}
+
+// Get the time since the current search started, in milliseconds.
+func (searcher *Searcher) elapsedTime() int64 {
+	return int64(time.Since(searcher.startTime) / time.Millisecond)
+}
+
+// Determine if a score is a mate for the side to move in at most
+// the given number of moves.
+func isMateWithin(score, moves int) bool {
+	movesToMate := getMovesToMate(score)
+	return movesToMate > 0 && movesToMate <= moves
+}
+
+// Convert a score into the number of full moves until mate, if the score
+// is a mate score. Mate scores are PosInf or NegInf adjusted by the ply
+// from the root the mate occurs at, so if we're getting a huge number for
+// the score, we're mating, and should return mate in however many moves down
+// we found it. Otherwise if we get a huge negative number, we're getting mated
+// and should report the number of moves as negative. If the score isn't a mate
+// score, zero is returned.
+func getMovesToMate(score int) int {
+	if score > PosInf-MaxPly {
+		return (PosInf - score + 1) / 2
+	} else if score < NegInf+MaxPly {
+		return -(score - NegInf + 1) / 2
+	}
+	return 0
 }
 
 // Get the best move for the side to move in the current board
-func (searcher *Searcher) rootNegamax(depth int) (uint16, int) {
-	var moves []uint16
-	GenLegalMoves(&searcher.Board, &moves)
-	orderMoves(searcher, &moves, depth)
+func (searcher *Searcher) rootNegamax(depth, alpha, beta int) (uint16, int) {
+	// The best move found by the last iteration is searched first.
+	moves := searcher.moveBuffer(0)
+	GenLegalMoves(&searcher.Board, moves)
+	prevBestMove := NullMove
+	if len(searcher.bestPV) > 0 {
+		prevBestMove = searcher.bestPV[0]
+	}
+	orderMoves(searcher, moves, searcher.killerMoves[0], prevBestMove, NullMove)
 
-	alpha, beta := NegInf, PosInf-1
-	bestMove, bestScore := NullMove, NegInf
+	// Start with the first move that can be searched as the best move, so a
+	// legal move is returned even if none of the moves raise alpha, such as
+	// when every move loses.
+	bestMove := NullMove
+	for _, move := range *moves {
+		if !searcher.isExcludedRootMove(move) {
+			bestMove = move
+			break
+		}
+	}
+	searcher.pvLength[0] = 0
+	searcher.iterationDepth = depth
 
-	for _, move := range moves {
-		fmt.Printf("info currmove %v\n", ConvertMoveToLongAlgebraicNotation(move))
+	for _, move := range *moves {
+		if searcher.isExcludedRootMove(move) {
+			continue
+		}
+		if searcher.reportInfo {
+			fmt.Printf("info currmove %v\n", ConvertMoveToLongAlgebraicNotation(move))
+		}
 		searcher.Board.DoMove(&move, true)
-		bestScore = -searcher.negamax(depth-1, -beta, -alpha)
+		score := -searcher.negamax(depth-1, 1, -beta, -alpha, move)
 		searcher.Board.UndoMove(&move)
+		if searcher.aborted {
+			return bestMove, alpha
+		}
 
-		if bestScore > alpha {
-			alpha = bestScore
+		if score >= beta {
+			searcher.updatePV(0, move)
+			return move, beta
+		}
+		if score > alpha {
+			alpha = score
 			bestMove = move
+			searcher.updatePV(0, move)
 		}
-		if bestScore >= beta {
-			break
+	}
+
+	// If no move raised alpha, the principal variation is just the move
+	// returned.
+	if searcher.pvLength[0] == 0 && bestMove != NullMove {
+		searcher.pvTable[0][0] = bestMove
+		searcher.pvLength[0] = 1
+	}
+	return bestMove, alpha
+}
+
+// Determine if a root move starts a line already found, when searching
+// for more than one line.
+func (searcher *Searcher) isExcludedRootMove(move uint16) bool {
+	for _, excludedMove := range searcher.excludedRootMoves {
+		if move == excludedMove {
+			return true
 		}
 	}
-	return bestMove, bestScore
+	return false
 }
 
 // The root negamax function in the searcher calls this main
 // negamax function, which only returns an integer value representing
 // the score of the best move found, which is all that's needed for
-// the top-level call to get a best move.
-func (searcher *Searcher) negamax(depth, alpha, beta int) int {
-	if score := searcher.getEntry(depth, alpha, beta); score != NoEntryFlag {
-		searcher.TTHits++
+// the top-level call to get a best move. Along with the depth left to
+// search, the ply (distance from the root) of the node is tracked so
+// mate scores can be given relative to the root, and the move that led
+// to the node is passed along to find its countermove.
+func (searcher *Searcher) negamax(depth, ply, alpha, beta int, prevMove uint16) int {
+	searcher.pvLength[ply] = ply
+
+	// Positions where the side to move is in check are forcing, so
+	// search them a ply deeper. The extension is made before probing the
+	// transposition table, so entries for the position are always stored
+	// and probed with the same depth. To keep long sequences of checks
+	// from exploding the search, the number of extensions along a line is
+	// capped at the depth of the current iteration.
+	inCheck := searcher.Board.InCheck()
+	if inCheck && ply+depth < min(2*searcher.iterationDepth, MaxPly) {
+		depth++
+	}
+
+	// Every node the main search reaches is counted here, including the
+	// nodes on the horizon handed off to the quiescence search, which
+	// only counts the nodes it recurses into itself.
+	searcher.NodesExplored++
+	if searcher.checkAbort() {
+		return 0
+	}
+
+	// A position repeated from earlier in the game or the search is scored
+	// as a draw, since whichever side can do no better can keep repeating
+	// it. Like the fifty-move rule below, this is checked before probing
+	// the transposition table, since the table doesn't know how the
+	// position was reached.
+	if searcher.Board.IsRepetition() {
+		return searcher.drawValue(ply)
+	}
+
+	// The game is drawn by the fifty-move rule, unless the move that
+	// reached the limit delivered checkmate. This is checked before
+	// probing the transposition table, since the half-move clock isn't
+	// part of the hash, so an entry for the same position might not be
+	// a draw.
+	if searcher.Board.HalfMoveClock >= FiftyMoveRuleLimit {
+		if inCheck {
+			moves := searcher.moveBuffer(ply)
+			GenLegalMoves(&searcher.Board, moves)
+			if len(*moves) == 0 {
+				return NegInf + ply
+			}
+		}
+		return searcher.drawValue(ply)
+	}
+
+	// Neither side can checkmate the other, so the position is a draw.
+	if searcher.Board.IsInsufficientMaterial() {
+		return searcher.drawValue(ply)
+	}
+
+	// Mate-distance pruning: the best the side to move can do is mate on
+	// the next move, and the worst is being mated right now, so if a mate
+	// already found elsewhere is shorter, nothing here can improve on it.
+	alpha = max(alpha, NegInf+ply)
+	beta = min(beta, PosInf-ply)
+	if alpha >= beta {
+		return alpha
+	}
+
+	score, ttMove, ttUpperBound := searcher.getEntry(depth, ply, alpha, beta)
+	if score != NoEntryFlag {
 		return score
 	}
 
+	// On the horizon, drop into the quiescence search. It searches every
+	// evasion when the side to move is in check, so mates delivered on
+	// the last ply of the search are still scored as mates, and there's
+	// no need to generate the legal moves here.
 	if depth == 0 {
-		searcher.NodesExplored++
-		score := evaluateBoard(searcher)
-		searcher.setEntry(depth, score, ExactFlag)
-		return searcher.quiescence(QuiesenceSearchDepth, alpha, beta)
+		return searcher.quiescence(QuiesenceSearchDepth, ply, alpha, beta)
 	}
 
-	var moves []uint16
-	GenLegalMoves(&searcher.Board, &moves)
+	// The squares each side attacks are needed by both the move generator
+	// and the evaluation, so they're only computed once. In check, the
+	// position isn't evaluated, and the move generator needs the squares
+	// the enemy attacks with our king removed, so they aren't needed.
+	var attacks *attackInfo
+	if !inCheck {
+		attacks = searcher.attackBuffer(ply)
+	}
+	moves := searcher.moveBuffer(ply)
+	genLegalMoves(&searcher.Board, attacks, moves)
 
-	if len(moves) == 0 {
-		if searcher.Board.InCheck() {
-			searcher.setEntry(depth, NegInf+(SearchDepth-depth), ExactFlag)
-			return NegInf + (SearchDepth - depth)
+	if len(*moves) == 0 {
+		if inCheck {
+			searcher.setEntry(depth, ply, NegInf+ply, ExactFlag, NullMove)
+			return NegInf + ply
 		}
-		searcher.setEntry(depth, 0, ExactFlag)
-		return 0
+		// The score of a draw depends on the contempt and on which side
+		// is to move at the root, so it isn't stored in the table, where
+		// it could be read back from the other side's point of view.
+		return searcher.drawValue(ply)
+	}
+
+	// The static evaluation is used by the pruning below, which isn't
+	// safe when the side to move is in check.
+	staticEval := 0
+	if !inCheck {
+		staticEval = evaluateBoard(&searcher.Board, attacks)
+	}
+
+	// Close to the horizon, if the static evaluation is so far above beta
+	// that the side to move can likely give up a lot and still fail high,
+	// don't bother searching. Neither is done if the transposition table
+	// has an entry showing the position scores below beta, or beta is a
+	// mate score, since mates can't be made up for by material.
+	if depth <= ReverseFutilityMaxDepth && !inCheck && getMovesToMate(beta) == 0 &&
+		ttUpperBound >= beta && staticEval-ReverseFutilityMargin*depth >= beta {
+		return beta
 	}
 
-	orderMoves(searcher, &moves, depth)
+	// Close to the horizon, quiet moves are unlikely to make up for a
+	// static evaluation far below alpha. This is only trusted when alpha
+	// isn't a mate score, for the same reason.
+	canFutilityPrune := depth <= FutilityMaxDepth && !inCheck && getMovesToMate(alpha) == 0 &&
+		staticEval+FutilityMargin*depth <= alpha
+
+	counterMove := NullMove
+	if prevMove != NullMove {
+		counterMove = searcher.counterMoves[getMoveFromSq(prevMove)][getMoveToSq(prevMove)]
+	}
+	moveScores := searcher.moveScoreBuffer(ply, len(*moves))
+	scoreMoves(searcher, moves, moveScores, searcher.killerMoves[ply], ttMove, counterMove)
 	entryFlag := AlphaFlag
+	bestMove := NullMove
 
-	for _, move := range moves {
+	for moveIndex := range *moves {
+		pickMove(moves, moveScores, moveIndex)
+		move := (*moves)[moveIndex]
 		searcher.Board.DoMove(&move, true)
-		score := -searcher.negamax(depth-1, -beta, -alpha)
+
+		// Skip quiet moves that don't give check once futility pruning
+		// applies, but always search the first move.
+		if canFutilityPrune && moveIndex > 0 && getMoveType(move) == Quiet && !searcher.Board.InCheck() {
+			searcher.Board.UndoMove(&move)
+			continue
+		}
+
+		// Moves ordered late in the move list are unlikely to be best, so
+		// search quiet ones with a reduced depth and a null window first,
+		// and only search them fully if they turn out to beat alpha.
+		score := 0
+		fullSearch := true
+		if searcher.canReduce(move, moveIndex, depth, ply, inCheck) {
+			reduction := LateMoveReductions[min(depth, MaxPly)][min(moveIndex, 63)]
+			score = -searcher.negamax(depth-1-reduction, ply+1, -alpha-1, -alpha, move)
+			fullSearch = score > alpha
+		}
+		if fullSearch {
+			score = -searcher.negamax(depth-1, ply+1, -beta, -alpha, move)
+		}
 		searcher.Board.UndoMove(&move)
+		if searcher.aborted {
+			return 0
+		}
 		if score >= beta {
-			searcher.setEntry(depth, beta, BetaFlag)
-			if getMoveType(move) != Attack && getMoveType(move) != AttackEP {
-				searcher.killerMoves[depth-1][1] = searcher.killerMoves[depth-1][0]
-				searcher.killerMoves[depth-1][0] = move
+			searcher.setEntry(depth, ply, beta, BetaFlag, move)
+			if isQuietMove(move) {
+				searcher.killerMoves[ply][1] = searcher.killerMoves[ply][0]
+				searcher.killerMoves[ply][0] = move
+				if prevMove != NullMove {
+					searcher.counterMoves[getMoveFromSq(prevMove)][getMoveToSq(prevMove)] = move
+				}
+
+				// Reward the move for causing a cutoff, and since the quiet
+				// moves searched before it didn't, lower their scores.
+				searcher.updateHistory(move, depth*depth)
+				for _, searchedMove := range (*moves)[:moveIndex] {
+					if isQuietMove(searchedMove) {
+						searcher.updateHistory(searchedMove, -depth*depth)
+					}
+				}
 			}
 			return beta
 		}
 		if score > alpha {
 			entryFlag = ExactFlag
 			alpha = score
-			if getMoveType(move) != Attack && getMoveType(move) != AttackEP {
-				searcher.searchHistory[getMoveFromSq(move)][getMoveToSq(move)] = depth * depth
-			}
+			bestMove = move
+			searcher.updatePV(ply, move)
 		}
 	}
-	searcher.setEntry(depth, alpha, entryFlag)
+	searcher.setEntry(depth, ply, alpha, entryFlag, bestMove)
 	return alpha
 }
 
-func (searcher *Searcher) quiescence(depth, alpha, beta int) int {
-	stand_pat := evaluateBoard(searcher)
+// Get the score of a draw for the side to move at the given ply. The side
+// to move at the root is the one at every even ply, and the contempt is
+// given from its point of view, so the sign flips with the side to move.
+func (searcher *Searcher) drawValue(ply int) int {
+	if ply%2 == 0 {
+		return DrawValue - searcher.Contempt
+	}
+	return DrawValue + searcher.Contempt
+}
+
+func (searcher *Searcher) quiescence(depth, ply, alpha, beta int) int {
+	if searcher.checkAbort() {
+		return 0
+	}
+
+	// If we're in check, standing pat isn't safe, since the position might
+	// be lost no matter what we do, so every evasion is searched instead of
+	// just the captures, and having no evasions means we've been mated.
+	attacks := searcher.attackBuffer(ply)
+	inCheck := attacks.inCheck(&searcher.Board)
+	moves := searcher.moveBuffer(ply)
+	if inCheck {
+		genLegalMoves(&searcher.Board, attacks, moves)
+		if len(*moves) == 0 {
+			return NegInf + ply
+		}
+	}
+
+	stand_pat := evaluateBoard(&searcher.Board, attacks)
 	if depth == 0 {
-		searcher.NodesExplored++
 		return stand_pat
 	}
-	if stand_pat >= beta {
-		return beta
-	}
-	if alpha < stand_pat {
-		alpha = stand_pat
+	if !inCheck {
+		if stand_pat >= beta {
+			return beta
+		}
+		if alpha < stand_pat {
+			alpha = stand_pat
+		}
+		genCaptureMoves(&searcher.Board, attacks, moves)
 	}
+	moveScores := searcher.moveScoreBuffer(ply, len(*moves))
+	scoreMoves(searcher, moves, moveScores, [2]uint16{}, NullMove, NullMove)
 
-	var moves []uint16
-	GenLegalMoves(&searcher.Board, &moves)
-	orderMoves(searcher, &moves, depth)
+	for moveIndex := range *moves {
+		pickMove(moves, moveScores, moveIndex)
+		move := (*moves)[moveIndex]
 
-	for _, move := range moves {
-		_, _, moveType := GetMoveInfo(move)
-		if moveType == Attack || move == AttackEP {
-			searcher.Board.DoMove(&move, true)
-			score := -searcher.quiescence(depth-1, -beta, -alpha)
-			searcher.Board.UndoMove(&move)
+		// If we're so far behind that even winning the captured piece won't
+		// bring the score back up to alpha, don't bother searching the capture.
+		_, to, moveType := GetMoveInfo(move)
+		capturedValue := PawnValue
+		if moveType != AttackEP {
+			capturedValue = getPieceValue(GetPieceType(searcher.Board.Pieces[to]))
+		}
+		margin := DeltaMargin
+		if moveType >= KnightPromotion {
+			margin += PromotionDeltaMargin
+		}
+		if !inCheck && stand_pat+capturedValue+margin < alpha {
+			continue
+		}
 
-			if score >= beta {
-				return beta
-			}
-			if score > alpha {
-				alpha = score
-			}
+		searcher.Board.DoMove(&move, true)
+		searcher.NodesExplored++
+		searcher.QNodesExplored++
+		score := -searcher.quiescence(depth-1, ply+1, -beta, -alpha)
+		searcher.Board.UndoMove(&move)
+		if searcher.aborted {
+			return 0
+		}
+
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
 		}
 	}
 	return alpha
 }
 
-// A helper function to probe the transpositon table
-func (searcher *Searcher) getEntry(depth, alpha, beta int) int {
-	entry := searcher.ttable[searcher.Board.Hash%TTSize]
-	if entry.Hash == searcher.Board.Hash {
-		if entry.Depth >= depth {
-			if entry.Flag == ExactFlag {
-				return entry.Value
+// Get the buffer of moves for the given ply, emptied so the moves of the
+// node being searched can be generated into it.
+func (searcher *Searcher) moveBuffer(ply int) *[]uint16 {
+	if searcher.moveBuffers[ply] == nil {
+		searcher.moveBuffers[ply] = make([]uint16, 0, MoveBufferSize)
+	}
+	searcher.moveBuffers[ply] = searcher.moveBuffers[ply][:0]
+	return &searcher.moveBuffers[ply]
+}
+
+// Get the attack information for the current position (see attackInfo),
+// computed into the buffer for the given ply, so it can be shared by the
+// move generator and the evaluation without being allocated at every node.
+func (searcher *Searcher) attackBuffer(ply int) *attackInfo {
+	attacks := &searcher.attackBuffers[ply]
+	attacks.init(&searcher.Board)
+	return attacks
+}
+
+// Get the buffer of move scores for the given ply, with room for the
+// given number of moves.
+func (searcher *Searcher) moveScoreBuffer(ply, numMoves int) []int {
+	if cap(searcher.moveScoreBuffers[ply]) < numMoves {
+		searcher.moveScoreBuffers[ply] = make([]int, max(numMoves, MoveBufferSize))
+	}
+	return searcher.moveScoreBuffers[ply][:numMoves]
+}
+
+// Update the principal variation at the given ply, after a move
+// was found which raised alpha. The new line is the move followed
+// by the line found from the child node it leads to.
+func (searcher *Searcher) updatePV(ply int, move uint16) {
+	searcher.pvTable[ply][ply] = move
+	childLength := searcher.pvLength[ply+1]
+	copy(searcher.pvTable[ply][ply+1:childLength], searcher.pvTable[ply+1][ply+1:childLength])
+	searcher.pvLength[ply] = max(childLength, ply+1)
+}
+
+// Get the principal variation found by the last completed search.
+func (searcher *Searcher) getPV() []uint16 {
+	pv := make([]uint16, searcher.pvLength[0])
+	copy(pv, searcher.pvTable[0][:searcher.pvLength[0]])
+	return pv
+}
+
+// Convert a principal variation to a string of moves in long
+// algebraic notation, as used in UCI info lines.
+func pvToString(pv []uint16) string {
+	moves := make([]string, len(pv))
+	for index, move := range pv {
+		moves[index] = ConvertMoveToLongAlgebraicNotation(move)
+	}
+	return strings.Join(moves, " ")
+}
+
+// A helper function to probe the transpositon table. Along with the score,
+// the best move stored for the position is returned, even if the entry's
+// score can't be used, so it can still be searched first. So is an upper
+// bound on the position's score, from an entry of any depth, which is
+// PosInf if the entry doesn't give one.
+func (searcher *Searcher) getEntry(depth, ply, alpha, beta int) (int, uint16, int) {
+	entry := &searcher.ttable[searcher.Board.Hash%uint64(len(searcher.ttable))]
+	key, data := atomic.LoadUint64(&entry.Key), atomic.LoadUint64(&entry.Data)
+	searcher.TTProbes++
+	if key^data == searcher.Board.Hash {
+		searcher.TTHits++
+		entryDepth, entryValue, entryFlag, _, bestMove := unpackTTData(data)
+		entryValue = scoreFromTT(entryValue, ply)
+		upperBound := PosInf
+		if entryFlag == ExactFlag || entryFlag == AlphaFlag {
+			upperBound = entryValue
+		}
+		if entryDepth >= depth {
+			if entryFlag == ExactFlag {
+				return entryValue, bestMove, upperBound
 			}
-			if entry.Flag == AlphaFlag && entry.Value <= alpha {
-				return alpha
+			if entryFlag == AlphaFlag && entryValue <= alpha {
+				return alpha, bestMove, upperBound
 			}
-			if entry.Flag == BetaFlag && entry.Value >= beta {
-				return beta
+			if entryFlag == BetaFlag && entryValue >= beta {
+				return beta, bestMove, upperBound
 			}
 		}
+		return NoEntryFlag, bestMove, upperBound
 	}
-	return NoEntryFlag
+	return NoEntryFlag, NullMove, PosInf
 }
 
-func (searcher *Searcher) setEntry(depth, value int, flag uint8) {
-	entry := &searcher.ttable[searcher.Board.Hash%TTSize]
-	entry.Hash = searcher.Board.Hash
-	entry.Value = value
-	entry.Flag = flag
-	entry.Depth = depth
+// Store an entry in the transposition table. Deeper entries are more
+// expensive to recompute, so an entry from the current search is only
+// replaced by one searched at least as deep.
+func (searcher *Searcher) setEntry(depth, ply, value int, flag uint8, bestMove uint16) {
+	entry := &searcher.ttable[searcher.Board.Hash%uint64(len(searcher.ttable))]
+	entryDepth, _, _, entryGeneration, _ := unpackTTData(atomic.LoadUint64(&entry.Data))
+	if depth < entryDepth && entryGeneration == searcher.generation {
+		return
+	}
+
+	data := packTTData(depth, scoreToTT(value, ply), flag, searcher.generation, bestMove)
+	atomic.StoreUint64(&entry.Key, searcher.Board.Hash^data)
+	atomic.StoreUint64(&entry.Data, data)
+}
+
+// Mate scores are relative to the root, but the same position can be reached
+// at different distances from the root, so they're stored in the transposition
+// table relative to the position itself, by adding the distance from the root
+// to mates found for the side to move, and subtracting it from mates found
+// against them.
+func scoreToTT(score, ply int) int {
+	if score > PosInf-MaxPly {
+		return score + ply
+	} else if score < NegInf+MaxPly {
+		return score - ply
+	}
+	return score
 }
 
-// Order the moves with those that are most likley to be best (e.g.
-// capturing a piece with a pawn), to optimize alpha-beta pruning.
-func orderMoves(searcher *Searcher, moves *[]uint16, depth int) {
+// Convert a mate score stored in the transposition table back to one
+// relative to the root, for a position the given distance from the root.
+func scoreFromTT(score, ply int) int {
+	if score > PosInf-MaxPly {
+		return score - ply
+	} else if score < NegInf+MaxPly {
+		return score + ply
+	}
+	return score
+}
+
+// Pack the depth, value, flag, generation, and best move of a transposition
+// table entry into a single 64-bit word. The value is stored in the low 24
+// bits, which is plenty for any score, the depth, flag, and generation in
+// the next 8 bits each, and the best move in the top 16.
+func packTTData(depth, value int, flag, generation uint8, bestMove uint16) uint64 {
+	return uint64(uint32(int32(value)))&0xFFFFFF | uint64(uint8(depth))<<24 | uint64(flag)<<32 |
+		uint64(generation)<<40 | uint64(bestMove)<<48
+}
+
+// Unpack the depth, value, flag, generation, and best move of a
+// transposition table entry.
+func unpackTTData(data uint64) (depth, value int, flag, generation uint8, bestMove uint16) {
+	// Shift the value up to the top of a 32-bit integer and back down
+	// to sign extend it.
+	value = int(int32(uint32(data)<<8) >> 8)
+	return int(uint8(data >> 24)), value, uint8(data >> 32), uint8(data >> 40), uint16(data >> 48)
+}
+
+// Estimate how full the transposition table is, in permille, from how
+// many of its first thousand entries have been filled.
+func (searcher *Searcher) hashfull() uint64 {
+	sampleSize := min(1000, len(searcher.ttable))
+	var used uint64
+	for index := 0; index < sampleSize; index++ {
+		entry := &searcher.ttable[index]
+		if atomic.LoadUint64(&entry.Key) != NullHash || atomic.LoadUint64(&entry.Data) != 0 {
+			used++
+		}
+	}
+	return used * 1000 / uint64(sampleSize)
+}
+
+// Determine if a move is quiet for the purposes of the killer moves and the
+// history table, which is any move that doesn't capture a piece, other than
+// a promotion capture.
+func isQuietMove(move uint16) bool {
+	return getMoveType(move) != Attack && getMoveType(move) != AttackEP
+}
+
+// Raise the history score of a quiet move by the given bonus, or lower it
+// if the bonus is negative. The closer a score is to MaxHistoryScore in
+// the direction of the bonus, the more the bonus is scaled down, so scores
+// never grow past the cap, and a move that's been good in the past can
+// still be overtaken by one that's good now.
+func (searcher *Searcher) updateHistory(move uint16, bonus int) {
+	bonus = max(-MaxHistoryScore, min(bonus, MaxHistoryScore))
+	score := &searcher.searchHistory[getMoveFromSq(move)][getMoveToSq(move)]
+	*score += bonus - *score*abs(bonus)/MaxHistoryScore
+}
+
+// Age the history table by halving every score in it. This is done
+// before each new search, so moves that were good in recent searches
+// are favored over moves that were only good much earlier in the game.
+func (searcher *Searcher) ageHistory() {
+	for from := 0; from < 64; from++ {
+		for to := 0; to < 64; to++ {
+			searcher.searchHistory[from][to] /= 2
+		}
+	}
+}
+
+// Get the history score of a quiet move, which is higher the more often
+// the move has caused a beta cutoff in recent searches. This is useful for
+// debugging the move ordering.
+func (searcher *Searcher) HistoryScore(move uint16) int {
+	return searcher.searchHistory[getMoveFromSq(move)][getMoveToSq(move)]
+}
+
+// Determine whether a move can be searched with a reduced depth. Only
+// quiet moves ordered late in the move list are reduced, and never
+// killer moves, or moves made while in check or that give check, since
+// those positions are too tactical to safely search less deeply. This
+// should be called once the move has been made on the board.
+func (searcher *Searcher) canReduce(move uint16, moveIndex, depth, ply int, inCheck bool) bool {
+	if moveIndex < LMRMinMoveIndex || depth < LMRMinDepth || inCheck {
+		return false
+	}
+	if getMoveType(move) != Quiet {
+		return false
+	}
+	if searcher.killerMoves[ply][0] == move || searcher.killerMoves[ply][1] == move {
+		return false
+	}
+	return !searcher.Board.InCheck()
+}
+
+// Order the moves with those that are most likley to be best first (see
+// scoreMoves). This sorts every move up front, which is only done at the
+// root, since all of its moves are searched. Other nodes often stop after
+// the first move or two, so they pick the moves in order as they go
+// instead (see pickMove).
+func orderMoves(searcher *Searcher, moves *[]uint16, killers [2]uint16, ttMove, counterMove uint16) {
 	moveScores := make([]int, len(*moves))
+	scoreMoves(searcher, moves, moveScores, killers, ttMove, counterMove)
+	sortMoves(moves, &moveScores)
+}
+
+// Score the moves by how likley they are to be best (e.g. capturing a
+// piece with a pawn), to optimize alpha-beta pruning. The best move from
+// the transposition table, if there is one, scores highest, and the killer
+// moves of the node's ply score below the captures.
+func scoreMoves(searcher *Searcher, moves *[]uint16, moveScores []int, killers [2]uint16, ttMove, counterMove uint16) {
 	for moveIndex, move := range *moves {
 		from, to, moveType := GetMoveInfo(move)
-		movePieceType := GetPieceType(searcher.Board.Pieces[from])
 		capturePieceType := GetPieceType(searcher.Board.Pieces[to])
 
-		if moveType == Attack || moveType == AttackEP {
-			moveScores[moveIndex] = getPieceValue(capturePieceType) - getPieceValue(movePieceType) + CaptureBonus
-		} else if moveType == KnightPromotion {
-			moveScores[moveIndex] = KnightValue + getPieceValue(capturePieceType)
-		} else if moveType == BishopPromotion {
-			moveScores[moveIndex] = BishopValue + getPieceValue(capturePieceType)
-		} else if moveType == RookPromotion {
-			moveScores[moveIndex] = RookValue + getPieceValue(capturePieceType)
-		} else if moveType == QueenPromotion {
-			moveScores[moveIndex] = QueenValue + getPieceValue(capturePieceType)
-		} else if searcher.killerMoves[depth-1][0] == move {
+		if move == ttMove {
+			moveScores[moveIndex] = TTMoveBonus
+		} else if moveType == Attack || moveType == AttackEP {
+			// Order captures by how much material they win once the whole
+			// exchange is played out, and place captures which lose material
+			// after the killer moves.
+			if seeScore := see(&searcher.Board, move); seeScore >= 0 {
+				moveScores[moveIndex] = seeScore + CaptureBonus
+			} else {
+				moveScores[moveIndex] = seeScore + SecondKillerBonus
+			}
+		} else if moveType >= KnightPromotion {
+			promotionType := KnightBB + int(moveType-KnightPromotion)
+			moveScores[moveIndex] = PromotionScores[capturePieceType][promotionType]
+		} else if killers[0] == move {
 			moveScores[moveIndex] = FirstKillerBonus
-		} else if searcher.killerMoves[depth-1][1] == move {
+		} else if killers[1] == move {
 			moveScores[moveIndex] = SecondKillerBonus
+		} else if move == counterMove {
+			moveScores[moveIndex] = CounterMoveBonus
 		} else {
-			moveScores[moveIndex] = searcher.searchHistory[from][to]
+			// Offset the history score so quiet moves are always ordered
+			// after killer moves and captures, however high their history.
+			moveScores[moveIndex] = searcher.searchHistory[from][to] - MaxHistoryScore
 		}
 	}
-	sortMoves(moves, &moveScores)
+}
+
+// Move the best scoring of the moves from the given index onwards to that
+// index, along with its score, so the moves can be searched in order without
+// sorting all of them up front. The moves skipped over are shifted along
+// instead of swapped, so moves with equal scores keep their order, and the
+// moves come out in the same order as sortMoves gives.
+func pickMove(moves *[]uint16, moveScores []int, index int) {
+	bestIndex := index
+	for moveIndex := index + 1; moveIndex < len(*moves); moveIndex++ {
+		if moveScores[moveIndex] > moveScores[bestIndex] {
+			bestIndex = moveIndex
+		}
+	}
+	if bestIndex == index {
+		return
+	}
+
+	bestMove, bestScore := (*moves)[bestIndex], moveScores[bestIndex]
+	copy((*moves)[index+1:bestIndex+1], (*moves)[index:bestIndex])
+	copy(moveScores[index+1:bestIndex+1], moveScores[index:bestIndex])
+	(*moves)[index], moveScores[index] = bestMove, bestScore
 }
 
 // A helper function to sort the moves given an array with a moves
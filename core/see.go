@@ -0,0 +1,91 @@
+package core
+
+/* This file contains the static exchange evaluation (SEE) used to order
+captures. Rather than only looking at the value of the piece captured and
+the piece capturing it, SEE plays out the whole sequence of captures on
+the target square, each side always recapturing with its least valuable
+piece, and returns the material the side making the first capture can
+expect to win (or lose) from the exchange.
+*/
+
+// Compute the static exchange evaluation of a capture. Pieces taking
+// part in the exchange are lifted off the board as it's played out, so
+// sliders lined up behind them (x-rays) can join in when it's their turn.
+// The board is returned to its original state before returning.
+func see(board *Board, move uint16) int {
+	from, to, moveType := GetMoveInfo(move)
+	toBB := setSingleBit(to)
+
+	var gains [32]int
+	var liftedSqs [32]int
+	var liftedPieces [32]uint8
+	lifted := 0
+
+	lift := func(sq int) {
+		liftedSqs[lifted] = sq
+		liftedPieces[lifted] = board.Pieces[sq]
+		lifted++
+		board.removePiece(sq)
+	}
+
+	gains[0] = getPieceValue(GetPieceType(board.Pieces[to]))
+	if moveType == AttackEP {
+		gains[0] = PawnValue
+		capturePos := to - 8
+		if PieceColor(board.Pieces[from]) == BlackBB {
+			capturePos = to + 8
+		}
+		lift(capturePos)
+	}
+
+	attackerType := GetPieceType(board.Pieces[from])
+	sideColor, otherColor := BlackBB, WhiteBB
+	if PieceColor(board.Pieces[from]) == BlackBB {
+		sideColor, otherColor = WhiteBB, BlackBB
+	}
+	lift(from)
+
+	depth := 0
+	for ; ; sideColor, otherColor = otherColor, sideColor {
+		attackersBB := attackersOfSquare(board, sideColor, toBB)
+		if attackersBB == 0 {
+			break
+		}
+
+		var attackerPos int
+		for pieceType := PawnBB; pieceType <= KingBB; pieceType++ {
+			if typeBB := attackersBB & board.PieceBB[pieceType]; typeBB != 0 {
+				attackerPos = getLSBPos(typeBB)
+				break
+			}
+		}
+
+		depth++
+		gains[depth] = getPieceValue(attackerType) - gains[depth-1]
+		attackerType = GetPieceType(board.Pieces[attackerPos])
+		lift(attackerPos)
+
+		// A king can only capture if the other side can't
+		// recapture it in turn.
+		if attackerType == KingBB {
+			if attackersOfSquare(board, otherColor, toBB) != 0 {
+				depth--
+				break
+			}
+		}
+	}
+
+	for lifted > 0 {
+		lifted--
+		piece := liftedPieces[lifted]
+		board.putPiece(GetPieceType(piece), PieceColor(piece), liftedSqs[lifted])
+	}
+
+	// Each side can choose to stop the exchange instead of recapturing,
+	// so work backwards from the end of the exchange, letting each side
+	// take whichever is better for it.
+	for ; depth > 0; depth-- {
+		gains[depth-1] = -max(-gains[depth-1], gains[depth])
+	}
+	return gains[0]
+}
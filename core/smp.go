@@ -0,0 +1,91 @@
+package core
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+/* This file contains the code for searching with more than one thread,
+using Lazy SMP. Besides the main searcher, a helper searcher is started for
+each extra thread, and every helper searches the same root position as the
+main searcher, sharing its transposition table, but with its own board,
+killer moves, and history. The helpers never report anything to the GUI, and
+their results are never used directly. Instead, they fill the transposition
+table with entries the main searcher can use, which speeds it up.
+
+To keep the helpers from all searching the same nodes in the same order,
+every other helper skips the first iteration, so it's a depth ahead of the
+rest, and the threads quickly drift apart as they go.
+*/
+
+// The maximum number of threads the search can be asked to use.
+const MaxThreads = 256
+
+// A function each helper searcher calls before it starts searching, if it's
+// set. It's only meant for tests, such as checking that the search survives
+// one of its helpers panicking.
+var HelperSearchHook func()
+
+// Start a helper searcher searching the current position in the
+// background for each thread besides the main one.
+func (searcher *Searcher) startHelpers() {
+	threads := min(searcher.Threads, MaxThreads)
+	for len(searcher.helpers) < threads-1 {
+		searcher.helpers = append(searcher.helpers, &Searcher{})
+	}
+	searcher.helpers = searcher.helpers[:threads-1]
+
+	searcher.helperGroup = &sync.WaitGroup{}
+	for index, helper := range searcher.helpers {
+		helper.ttable = searcher.ttable
+		helper.generation = searcher.generation
+		helper.Contempt = searcher.Contempt
+		helper.Board = searcher.Board.Copy()
+		helper.ClearStop()
+		helper.stagger = (index + 1) % 2
+
+		searcher.helperGroup.Add(1)
+		go func(helper *Searcher) {
+			defer searcher.helperGroup.Done()
+
+			// A panic in a helper's goroutine would take the whole engine
+			// down with it, and the main searcher's recovery can't catch it.
+			// So log it, along with the position it happened in, and stop
+			// the main search, which plays the best move it's found so far.
+			root := helper.Board.Copy()
+			defer func() {
+				if err := recover(); err != nil {
+					log.Printf("helper search panicked in position %v: %v\n%s", root.ToFEN(), err, debug.Stack())
+					searcher.Stop()
+				}
+			}()
+
+			if HelperSearchHook != nil {
+				HelperSearchHook()
+			}
+			helper.iterativeDeepening(MaxPly, SearchLimits{})
+		}(helper)
+	}
+}
+
+// Stop the helper searchers, and wait for all of them to finish.
+func (searcher *Searcher) stopHelpers() {
+	for _, helper := range searcher.helpers {
+		helper.Stop()
+	}
+	searcher.helperGroup.Wait()
+}
+
+// Get the number of nodes searched so far by the current search, across
+// every thread. The helpers only share their node counts every so often
+// while they search, so the total is only approximate until they've been
+// stopped.
+func (searcher *Searcher) totalNodes() uint64 {
+	nodes := searcher.prevNodes
+	for _, helper := range searcher.helpers {
+		nodes += atomic.LoadUint64(&helper.sharedNodes)
+	}
+	return nodes
+}
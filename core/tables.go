@@ -303,7 +303,25 @@ var Rays [8][64]uint64 = [8][64]uint64{
 var LinesBewteen [64][64]uint64
 var LinesBetweenDirections [64][64]Direction
 
+// Masks of the squares in front of a pawn, on its own file and the
+// adjacent files. If no enemy pawns are on these squares, the pawn
+// is passed.
+var WhitePassedPawnMasks [64]uint64
+var BlackPassedPawnMasks [64]uint64
+
 func init() {
+	for sq := 0; sq < 64; sq++ {
+		file, rank := sq%8, sq/8
+		for adjacentFile := max(file-1, FileA); adjacentFile <= min(file+1, FileH); adjacentFile++ {
+			for frontRank := rank + 1; frontRank <= Rank8; frontRank++ {
+				setBit(&WhitePassedPawnMasks[sq], frontRank*8+adjacentFile)
+			}
+			for frontRank := rank - 1; frontRank >= Rank1; frontRank-- {
+				setBit(&BlackPassedPawnMasks[sq], frontRank*8+adjacentFile)
+			}
+		}
+	}
+
 	for sq1 := 0; sq1 < 64; sq1++ {
 		for direction := North; direction <= SouthWest; direction++ {
 			rayBetween := Rays[direction][sq1]
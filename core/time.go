@@ -0,0 +1,74 @@
+package core
+
+/* This file contains the time management used by the search. Given the
+time left on the engine's clock, its increment, and how many moves are left
+until the next time control, it decides how long the engine should spend
+searching its next move.
+
+Two limits are computed. The soft limit is how long we'd like to spend on
+the move, and once it's passed, no new iteration of the search is started.
+The hard limit is the most we can afford to spend on the move, and if it's
+passed partway through an iteration, the iteration is abandoned.
+*/
+
+const (
+	// The time, in milliseconds, held back on every move to make up for
+	// the lag between the GUI and the engine, so we never flag even if
+	// we use our whole budget.
+	MoveOverhead = 50
+
+	// When the GUI doesn't tell us how many moves are left until the next
+	// time control, we estimate it from the phase of the game, between
+	// these two values. More moves are expected to be left in the opening
+	// than in the endgame.
+	MinMovesToGoEstimate = 20
+	MaxMovesToGoEstimate = 40
+
+	// How much of the increment is added to the time budget of each move,
+	// as a fraction of IncrementDivisor.
+	IncrementShare   = 3
+	IncrementDivisor = 4
+
+	// How many times the soft limit the hard limit can be, and the most a
+	// single move can take of the time left on the clock, as a fraction of
+	// HardLimitDivisor.
+	HardLimitFactor  = 4
+	HardLimitShare   = 3
+	HardLimitDivisor = 4
+)
+
+// Compute the soft and hard time limits for a search, in milliseconds, from
+// the limits given by the GUI and the phase of the game (see Board.Phase). A
+// limit of zero means there's no time limit.
+func computeTimeBudget(limits SearchLimits, phase int) (soft, hard int64) {
+	if limits.MoveTime > 0 {
+		return limits.MoveTime, limits.MoveTime
+	}
+	if limits.TimeLeft <= 0 {
+		return 0, 0
+	}
+
+	movesToGo := int64(limits.MovesToGo)
+	if movesToGo <= 0 {
+		movesToGo = int64(MinMovesToGoEstimate +
+			(MaxMovesToGoEstimate-MinMovesToGoEstimate)*phase/MaxPhase)
+	}
+
+	available := limits.TimeLeft - MoveOverhead
+	if available < 1 {
+		available = 1
+	}
+
+	soft = available/movesToGo + limits.Increment*IncrementShare/IncrementDivisor
+	hard = soft * HardLimitFactor
+	if maxHard := available * HardLimitShare / HardLimitDivisor; hard > maxHard {
+		hard = maxHard
+	}
+	if hard < 1 {
+		hard = 1
+	}
+	if soft > hard {
+		soft = hard
+	}
+	return soft, hard
+}
@@ -155,7 +155,9 @@ func ConvertMoveToLongAlgebraicNotation(move uint16) string {
 	}
 }
 
-// Convert a move in UCI format to an interal move for Blunder
+// Convert a move in UCI format to an interal move for Blunder. In Chess960,
+// castling is given as the king capturing its own rook, rather than as a
+// two square king move.
 func ConvertLongAlgebraicNotationToMove(board *Board, moveAsString string) uint16 {
 	fromPos := CoordinateToPos(moveAsString[0:2])
 	toPos := CoordinateToPos(moveAsString[2:4])
@@ -173,6 +175,13 @@ func ConvertLongAlgebraicNotationToMove(board *Board, moveAsString string) uint1
 		} else if moveAsString[moveAsStringLen-1] == 'q' {
 			moveType = QueenPromotion
 		}
+	} else if board.Chess960 && movePieceType == KingBB && GetPieceType(board.Pieces[toPos]) == RookBB &&
+		PieceColor(board.Pieces[toPos]) == PieceColor(board.Pieces[fromPos]) {
+		for right, rookSq := range board.CastlingRookSqs {
+			if rookSq == toPos {
+				moveType = CastleWKS + right
+			}
+		}
 	} else if moveAsString == "e1g1" && movePieceType == KingBB {
 		moveType = CastleWKS
 	} else if moveAsString == "e1c1" && movePieceType == KingBB {
@@ -0,0 +1,89 @@
+package core
+
+import "fmt"
+
+// Verify that the incrementally updated state of the board is
+// consistent. The piece bitboards are recomputed from the mailbox
+// board, the Zobrist hash and the material and piece square table
+// scores are recomputed from scratch, and the castling
+// rights are checked against the actual positions of the kings and
+// rooks. An error describing the first inconsistency found is returned,
+// or nil if the board is consistent.
+func (board *Board) Verify() error {
+	var pieceBB [8]uint64
+	for pos, piece := range board.Pieces {
+		if piece != NoPiece {
+			setBit(&pieceBB[GetPieceType(piece)], pos)
+			setBit(&pieceBB[PieceColor(piece)], pos)
+		}
+	}
+	for index, bitboard := range pieceBB {
+		if bitboard != board.PieceBB[index] {
+			return fmt.Errorf("bitboard %d is 0x%x, but the mailbox board gives 0x%x",
+				index, board.PieceBB[index], bitboard)
+		}
+	}
+
+	if occupiedBB := pieceBB[WhiteBB] | pieceBB[BlackBB]; occupiedBB != board.Occupied {
+		return fmt.Errorf("occupied bitboard is 0x%x, but the mailbox board gives 0x%x", board.Occupied, occupiedBB)
+	}
+
+	for _, color := range []int{WhiteBB, BlackBB} {
+		kingBB := pieceBB[KingBB] & pieceBB[color]
+		if kingBB != 0 && board.KingSq[color] != getLSBPos(kingBB) {
+			return fmt.Errorf("king square is %v, but the mailbox board gives %v",
+				PosToCoordinate(board.KingSq[color]), PosToCoordinate(getLSBPos(kingBB)))
+		}
+	}
+
+	if hash := initZobristHash(board); hash != board.Hash {
+		return fmt.Errorf("zobrist hash is 0x%x, but should be 0x%x", board.Hash, hash)
+	}
+
+	materialScores, positionScores := board.computeEvalScores()
+	if materialScores != board.MaterialScores || positionScores != board.PositionScores {
+		return fmt.Errorf("material and piece square table scores are %v and %v, but should be %v and %v",
+			board.MaterialScores, board.PositionScores, materialScores, positionScores)
+	}
+
+	rights := []string{"white can castle kingside", "white can castle queenside", "black can castle kingside", "black can castle queenside"}
+	for right, canCastle := range rights {
+		if board.CastlingRights&(WhiteKingside>>right) == 0 {
+			continue
+		}
+
+		// In Chess960 the king can start anywhere on the back rank, as long
+		// as it's between the rooks, but in standard chess it's always on
+		// the e-file.
+		color, pieceColor, kingSq := WhiteBB, White, E1
+		if right >= BlackKingsideRook {
+			color, pieceColor, kingSq = BlackBB, Black, E8
+		}
+		king, rook := King|pieceColor, Rook|pieceColor
+		rookSq := board.CastlingRookSqs[right]
+
+		kingOK := board.Pieces[kingSq] == king
+		if board.Chess960 {
+			kingSq = getLSBPos(board.PieceBB[KingBB] & board.PieceBB[color])
+			kingOK = kingSq/8 == rookSq/8 && (kingSq < rookSq) == (right%2 == 0)
+		}
+		if !kingOK || board.Pieces[rookSq] != rook {
+			return fmt.Errorf("%v, but the king or rook has moved", canCastle)
+		}
+	}
+
+	if board.EPSquare != NoEPSquare && board.EPSquare/8 != Rank3 && board.EPSquare/8 != Rank6 {
+		return fmt.Errorf("en passant square %v is not on the third or sixth rank", PosToCoordinate(board.EPSquare))
+	}
+	return nil
+}
+
+// In debug builds, verify the board after a move has been made or unmade
+// and panic if it's inconsistent, so incremental update bugs are caught
+// as soon as they happen.
+func debugVerify(board *Board, move uint16, action string) {
+	if err := board.Verify(); err != nil {
+		board.PrintBoard()
+		panic(fmt.Sprintf("board inconsistent after %s %v: %v", action, MoveToStr(move), err))
+	}
+}
@@ -68,7 +68,7 @@ func isValidZobristEPSq(board *Board, EPsq int) bool {
 		epPawnPos = EPsq - 8
 	}
 
-	pawnColor := getPieceColor(board.Pieces[epPawnPos])
+	pawnColor := PieceColor(board.Pieces[epPawnPos])
 	enemyColor := WhiteBB
 	if pawnColor == WhiteBB {
 		enemyColor = BlackBB
@@ -87,7 +87,7 @@ func isValidZobristEPSq(board *Board, EPsq int) bool {
 }
 
 func getPieceHash(piece uint8, pos int) uint64 {
-	pieceType, pieceColor := GetPieceType(piece), getPieceColor(piece)
+	pieceType, pieceColor := GetPieceType(piece), PieceColor(piece)
 	if pieceColor == WhiteBB {
 		return Random64[(pieceType*2+1)*64+pos]
 	}
@@ -98,7 +98,7 @@ func getPieceHash(piece uint8, pos int) uint64 {
 // Use this function when debugging the engine as it checks that the piece
 // given is valid.
 func getPieceHashDebug(piece uint8, pos int) uint64 {
-	pieceType, pieceColor := GetPieceType(piece), getPieceColor(piece)
+	pieceType, pieceColor := GetPieceType(piece), PieceColor(piece)
 	if pieceType == PawnBB && pieceColor == BlackBB {
 		return Random64[BlackPawn*64+pos]
 	} else if pieceType == PawnBB && pieceColor == WhiteBB {
@@ -6,54 +6,155 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 // This file contains a basic program to play blunder
 // from the command line. Moves are entered in basic
 // coordinate notation
 
-func RunCommandLineProtocol() {
+// Play a game against Blunder from the command line. The starting position
+// (a FEN string or "startpos") and the color the player is playing can be
+// given as arguments, and if either is empty, the player is prompted for it.
+func RunCommandLineProtocol(fen, color string) {
 	reader := bufio.NewReader(os.Stdin)
 	var searcher core.Searcher
 	searcher.Init()
 
-	fmt.Println("Enter a fen string for the starting position (or startpos for the start position): ")
-	input, _ := reader.ReadString('\n')
+	fen = normalizeInput(fen)
+	for {
+		if fen == "" {
+			fen = promptForInput(reader, "Enter a fen string for the starting position (or startpos for the start position): ")
+		}
+		if fen == "startpos" {
+			fen = core.FENStartPosition
+		}
 
-	if input == "startpos\n" {
-		searcher.LoadFEN(core.FENStartPosition)
-	} else {
-		searcher.LoadFEN(strings.TrimSuffix(input, "\n"))
+		err := searcher.LoadFEN(fen)
+		if err == nil {
+			break
+		}
+		fmt.Printf("Invalid position: %v\n", err)
+		fen = ""
 	}
 
-	var playerToMove bool
-	fmt.Println("Are you white or black? ")
-	input, _ = reader.ReadString('\n')
+	color = strings.ToLower(normalizeInput(color))
+	for color != "white" && color != "black" {
+		if color != "" {
+			fmt.Printf("Invalid color \"%v\", please enter white or black.\n", color)
+		}
+		color = strings.ToLower(promptForInput(reader, "Are you white or black? "))
+	}
 
-	if input == "white\n" && searcher.Board.WhiteToMove {
-		playerToMove = true
-	} else if input == "black\n" && !searcher.Board.WhiteToMove {
-		playerToMove = true
+	playerToMove := (color == "white") == searcher.Board.WhiteToMove
+	if !playerToMove {
+		if searcher.Board.WhiteToMove {
+			fmt.Println("It's white to move in this position, so Blunder will move first.")
+		} else {
+			fmt.Println("It's black to move in this position, so Blunder will move first.")
+		}
 	}
 
+	// Keep track of how many times each position has occured,
+	// to detect draws by threefold repetition, and of the moves
+	// played, so the game can be given as PGN once it's over.
+	positionRepeats := make(map[uint64]int)
+	positionRepeats[searcher.Board.Hash]++
+	var startBoard core.Board
+	startBoard.LoadFEN(searcher.Board.ToFEN())
+	var movesPlayed []uint16
+	pgnResult := PGNUnknownResult
+
 	for {
 		searcher.Board.PrintBoard()
 
+		if result, isOver := getGameResult(&searcher.Board, positionRepeats); isOver {
+			fmt.Println("Game over:", result)
+			pgnResult = strings.Fields(result)[0]
+			break
+		}
+
 		if playerToMove {
 			fmt.Print("Enter your move (in uci protocol formation)> ")
-			input, _ = reader.ReadString('\n')
-			if input == "quit\n" {
+			input, err := reader.ReadString('\n')
+			input = normalizeInput(input)
+			if err != nil || input == "quit" {
 				break
 			}
-			input = strings.TrimSuffix(input, "\n")
-			searcher.Board.DoMoveFromCoords(input, false, false)
+			move := searcher.Board.DoMoveFromCoords(input, true, false)
+			movesPlayed = append(movesPlayed, move)
+			positionRepeats[searcher.Board.Hash]++
 			playerToMove = false
 		} else {
 			// No time restriction, so always pass in something above a 1:30 of time
 			// so Blunder won't think it has to rush.
-			bestMove := searcher.Search(core.TimeThreshHoldForBulletPlay + 1)
-			searcher.Board.DoMove(&bestMove, false)
+			bestMove := searcher.Search(core.SearchLimits{})
+			searcher.Board.DoMove(&bestMove, true)
+			movesPlayed = append(movesPlayed, bestMove)
+			positionRepeats[searcher.Board.Hash]++
 			playerToMove = true
 		}
 	}
+
+	white, black := "Player", EngineName
+	if color == "black" {
+		white, black = black, white
+	}
+	fmt.Println()
+	fmt.Print(WritePGN(&startBoard, movesPlayed, pgnResult, PGNTags{
+		Event: "Command line game",
+		Date:  time.Now().Format("2006.01.02"),
+		White: white,
+		Black: black,
+	}))
+}
+
+// Trim any surrounding whitespace, including the line ending, from a line
+// of input.
+func normalizeInput(input string) string {
+	return strings.TrimSpace(input)
+}
+
+// Prompt the player for a line of input, re-prompting until a
+// non-empty line is entered.
+func promptForInput(reader *bufio.Reader, prompt string) string {
+	for {
+		fmt.Print(prompt)
+		input, err := reader.ReadString('\n')
+		input = normalizeInput(input)
+		if input != "" {
+			return input
+		}
+		if err != nil {
+			fmt.Println()
+			os.Exit(1)
+		}
+	}
+}
+
+// Determine if the game has ended in the current position, and if so,
+// return a description of the result. The game is over once the side to
+// move is checkmated or stalemated, or it's drawn by insufficient material,
+// threefold repetition, or the fifty-move rule.
+func getGameResult(board *core.Board, positionRepeats map[uint64]int) (string, bool) {
+	if board.IsCheckmate() {
+		if board.WhiteToMove {
+			return "0-1 {Black mates}", true
+		}
+		return "1-0 {White mates}", true
+	}
+	if board.IsStalemate() {
+		return "1/2-1/2 {Stalemate}", true
+	}
+
+	if board.IsInsufficientMaterial() {
+		return "1/2-1/2 {Insufficient material}", true
+	}
+	if positionRepeats[board.Hash] >= 3 {
+		return "1/2-1/2 {Threefold repetition}", true
+	}
+	if board.HalfMoveClock >= core.FiftyMoveRuleLimit {
+		return "1/2-1/2 {Fifty-move rule}", true
+	}
+	return "", false
 }
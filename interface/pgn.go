@@ -0,0 +1,279 @@
+package inter
+
+import (
+	"blunder/core"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// This file contains a writer and a parser for PGN, the standard format
+// for recording chess games, so games played by Blunder can be saved and
+// reviewed in other chess programs, and recorded games can be fed into
+// Blunder for analysis.
+
+const (
+	// The width the movetext of a PGN game is wrapped at.
+	PGNLineWidth = 80
+
+	// The value of a tag that isn't known, and the result of a game
+	// that's still in progress (or whose result isn't known).
+	PGNUnknownTag    = "?"
+	PGNUnknownDate   = "????.??.??"
+	PGNUnknownResult = "*"
+)
+
+// The tags of the seven tag roster, besides the result, which every
+// PGN game has. Any tag left empty is written as unknown.
+type PGNTags struct {
+	Event string
+	Site  string
+	Date  string
+	Round string
+	White string
+	Black string
+}
+
+// Write the game made up of the given moves, played from the given starting
+// position, as PGN. The moves are written in SAN, and if the game didn't
+// start from the standard starting position, the FEN and SetUp tags are
+// included. The starting board isn't modified.
+func WritePGN(start *core.Board, moves []uint16, result string, tags PGNTags) string {
+	var board core.Board
+	startFEN := start.ToFEN()
+	board.LoadFEN(startFEN)
+	board.Chess960 = start.Chess960
+
+	if result == "" {
+		result = PGNUnknownResult
+	}
+
+	var pgn strings.Builder
+	writeTag := func(name, value, unknown string) {
+		if value == "" {
+			value = unknown
+		}
+		value = strings.ReplaceAll(strings.ReplaceAll(value, "\\", "\\\\"), "\"", "\\\"")
+		fmt.Fprintf(&pgn, "[%v \"%v\"]\n", name, value)
+	}
+	writeTag("Event", tags.Event, PGNUnknownTag)
+	writeTag("Site", tags.Site, PGNUnknownTag)
+	writeTag("Date", tags.Date, PGNUnknownDate)
+	writeTag("Round", tags.Round, PGNUnknownTag)
+	writeTag("White", tags.White, PGNUnknownTag)
+	writeTag("Black", tags.Black, PGNUnknownTag)
+	writeTag("Result", result, PGNUnknownResult)
+	if startFEN != core.FENStartPosition {
+		writeTag("SetUp", "1", "")
+		writeTag("FEN", startFEN, "")
+	}
+	pgn.WriteString("\n")
+
+	// Build the movetext one token at a time, so it can be wrapped between
+	// tokens. A game starting with black to move starts with "N...".
+	var tokens []string
+	for index, move := range moves {
+		if board.WhiteToMove {
+			tokens = append(tokens, fmt.Sprintf("%d.", board.FullMoveCounter))
+		} else if index == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", board.FullMoveCounter))
+		}
+		tokens = append(tokens, core.MoveToSAN(&board, move))
+		board.DoMove(&move, true)
+	}
+	tokens = append(tokens, result)
+
+	lineLength := 0
+	for _, token := range tokens {
+		if lineLength > 0 && lineLength+1+len(token) > PGNLineWidth {
+			pgn.WriteString("\n")
+			lineLength = 0
+		} else if lineLength > 0 {
+			pgn.WriteString(" ")
+			lineLength++
+		}
+		pgn.WriteString(token)
+		lineLength += len(token)
+	}
+	pgn.WriteString("\n")
+	return pgn.String()
+}
+
+// A game read from a PGN file: its tags, the FEN string of the position
+// it started from, the moves played, and its result.
+type Game struct {
+	Tags     map[string]string
+	StartFEN string
+	Moves    []uint16
+	Result   string
+}
+
+// Parse each of the games in a PGN file. The moves of each game are played
+// out on a board from its starting position, which is given by its FEN tag
+// if it has one. Comments, NAGs (e.g. $1), and variations are skipped.
+func ParsePGN(r io.Reader) ([]Game, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var games []Game
+	var game *Game
+	var board core.Board
+
+	// Start a new game if there isn't one in progress, and finish the one in
+	// progress. The board is only set up once the game's first move is read,
+	// since the FEN tag has to be read first.
+	startGame := func() {
+		if game == nil {
+			game = &Game{Tags: make(map[string]string), Result: PGNUnknownResult}
+		}
+	}
+	finishGame := func() {
+		if game != nil {
+			if game.StartFEN == "" {
+				game.StartFEN = getPGNStartFEN(game)
+			}
+			games = append(games, *game)
+			game = nil
+		}
+	}
+
+	text := string(input)
+	for index := 0; index < len(text); {
+		char := text[index]
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			index++
+		case char == '[':
+			// A tag after a game's movetext starts the next game.
+			if game != nil && len(game.Moves) > 0 {
+				finishGame()
+			}
+			startGame()
+			end := strings.IndexByte(text[index:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("game %d: unterminated tag", len(games)+1)
+			}
+			name, value, err := parsePGNTag(text[index+1 : index+end])
+			if err != nil {
+				return nil, fmt.Errorf("game %d: %v", len(games)+1, err)
+			}
+			game.Tags[name] = value
+			index += end + 1
+		case char == '{':
+			end := strings.IndexByte(text[index:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("game %d: unterminated comment", len(games)+1)
+			}
+			index += end + 1
+		case char == ';' || char == '%':
+			// Comments and escaped lines run to the end of the line.
+			end := strings.IndexByte(text[index:], '\n')
+			if end == -1 {
+				end = len(text) - index
+			}
+			index += end
+		case char == '(':
+			// Variations can be nested, and can contain comments
+			// with parentheses in them.
+			depth := 0
+			for ; index < len(text); index++ {
+				if text[index] == '{' {
+					if end := strings.IndexByte(text[index:], '}'); end != -1 {
+						index += end
+					}
+				} else if text[index] == '(' {
+					depth++
+				} else if text[index] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("game %d: unterminated variation", len(games)+1)
+			}
+			index++
+		default:
+			end := index
+			for end < len(text) && !strings.ContainsRune(" \t\n\r[]{}();", rune(text[end])) {
+				end++
+			}
+			if end == index {
+				return nil, fmt.Errorf("game %d: unexpected character '%c'", len(games)+1, char)
+			}
+			token := text[index:end]
+			index = end
+
+			startGame()
+			if token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*" {
+				game.Result = token
+				finishGame()
+				continue
+			}
+
+			// Skip NAGs and move numbers, which can be attached to the move
+			// following them (e.g. "1.e4" or "12...Nf6").
+			if token[0] == '$' {
+				continue
+			}
+			token = strings.TrimLeft(token, "0123456789")
+			token = strings.TrimLeft(token, ".")
+			if token == "" {
+				continue
+			}
+
+			if len(game.Moves) == 0 {
+				game.StartFEN = getPGNStartFEN(game)
+				board.Chess960 = isPGNChess960(game)
+				if err := board.LoadFEN(game.StartFEN); err != nil {
+					return nil, fmt.Errorf("game %d: %v", len(games)+1, err)
+				}
+			}
+			move, err := core.SANToMove(&board, token)
+			if err != nil {
+				return nil, fmt.Errorf("game %d: %v", len(games)+1, err)
+			}
+			board.DoMove(&move, true)
+			game.Moves = append(game.Moves, move)
+		}
+	}
+
+	finishGame()
+	return games, nil
+}
+
+// Parse the contents of a tag pair, without the surrounding brackets, such
+// as `Event "Casual game"`, into the tag's name and value.
+func parsePGNTag(tag string) (name, value string, err error) {
+	tag = strings.TrimSpace(tag)
+	fields := strings.SplitN(tag, " ", 2)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid tag \"%v\"", tag)
+	}
+
+	value = strings.TrimSpace(fields[1])
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", "", fmt.Errorf("invalid tag \"%v\": value isn't quoted", tag)
+	}
+	value = value[1 : len(value)-1]
+	value = strings.ReplaceAll(strings.ReplaceAll(value, "\\\"", "\""), "\\\\", "\\")
+	return fields[0], value, nil
+}
+
+// Get the FEN string of the position a game started from, which is the
+// standard starting position unless the game has a FEN tag.
+func getPGNStartFEN(game *Game) string {
+	if fen, ok := game.Tags["FEN"]; ok {
+		return fen
+	}
+	return core.FENStartPosition
+}
+
+// Determine if a game is a Chess960 game, going by its Variant tag.
+func isPGNChess960(game *Game) bool {
+	variant := strings.ToLower(game.Tags["Variant"])
+	return variant == "chess960" || variant == "fischerandom"
+}
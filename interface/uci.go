@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -16,14 +17,119 @@ const (
 	EngineName        = "Blunder 0.3"
 	EngineAuthor      = "Christian Dean"
 	BookMoveTimeDelay = 2
+
+	// The default file name of the opening book
+	DefaultBookName = "book.bin"
 )
 
-func uciCommandResponse() {
+// The polyglot opening book used by the engine, along with the
+// options the GUI can set to control it.
+type OpeningBook struct {
+	Enabled bool
+	Path    string
+	Entries map[uint64]PolyglotEntry
+}
+
+// Load the opening book from the given path. If we can't find the
+// opening book, we're not in the best situation, but we can play
+// without it, so don't make the program crash. Make an empty opening
+// book and move on.
+func (book *OpeningBook) Load(path string) {
+	book.Path = path
+	entries, err := LoadPolyglotFile(path)
+	if err != nil {
+		log.Println("Loading opening book failed:", err)
+		entries = make(map[uint64]PolyglotEntry)
+	}
+	book.Entries = entries
+}
+
+// Find the default location of the opening book. GUIs usually launch the
+// engine from a working directory we can't predict, so first look for the
+// book next to the engine's executable, and only fall back on the current
+// working directory if it's not there.
+func defaultBookPath() string {
+	if exePath, err := os.Executable(); err == nil {
+		bookPath := filepath.Join(filepath.Dir(exePath), DefaultBookName)
+		if _, err := os.Stat(bookPath); err == nil {
+			return bookPath
+		}
+	}
+	if workingDir, err := os.Getwd(); err == nil {
+		return filepath.Join(workingDir, DefaultBookName)
+	}
+	return DefaultBookName
+}
+
+func uciCommandResponse(book *OpeningBook) {
 	fmt.Printf("id name %v\n", EngineName)
 	fmt.Printf("id author %v\n", EngineAuthor)
+	fmt.Printf("option name OwnBook type check default true\n")
+	fmt.Printf("option name Ponder type check default false\n")
+	fmt.Printf("option name BookPath type string default %v\n", book.Path)
+	fmt.Printf("option name WhitePOVScore type check default false\n")
+	fmt.Printf("option name UCI_Chess960 type check default false\n")
+	fmt.Printf("option name MultiPV type spin default %v min 1 max %v\n", core.DefaultMultiPV, core.MaxMultiPV)
+	fmt.Printf("option name Contempt type spin default %v min %v max %v\n", core.DefaultContempt, -core.MaxContempt, core.MaxContempt)
+	fmt.Printf("option name Threads type spin default 1 min 1 max %v\n", core.MaxThreads)
+	fmt.Printf("option name Hash type spin default %v min %v max %v\n", core.DefaultTTSizeMB, core.MinTTSizeMB, core.MaxTTSizeMB)
 	fmt.Printf("uciok\n")
 }
 
+// Parse a setoption command of the form "setoption name <id> [value <x>]",
+// and return the option's name and value. Names and values can contain spaces.
+func parseSetoptionCommand(command string) (name, value string) {
+	fields := strings.Fields(strings.TrimPrefix(command, "setoption"))
+	var nameFields, valueFields []string
+	inValue := false
+	for _, field := range fields {
+		if field == "name" && !inValue && len(nameFields) == 0 {
+			continue
+		} else if field == "value" && !inValue {
+			inValue = true
+			continue
+		}
+		if inValue {
+			valueFields = append(valueFields, field)
+		} else {
+			nameFields = append(nameFields, field)
+		}
+	}
+	return strings.Join(nameFields, " "), strings.Join(valueFields, " ")
+}
+
+func setoptionCommandResponse(searcher *core.Searcher, book *OpeningBook, command string) {
+	name, value := parseSetoptionCommand(command)
+	switch strings.ToLower(name) {
+	case "ownbook":
+		book.Enabled = strings.ToLower(value) == "true"
+	case "bookpath":
+		if value != book.Path {
+			book.Load(value)
+		}
+	case "whitepovscore":
+		searcher.WhitePOVScore = strings.ToLower(value) == "true"
+	case "uci_chess960":
+		searcher.Board.Chess960 = strings.ToLower(value) == "true"
+	case "multipv":
+		if multiPV, err := strconv.Atoi(value); err == nil && multiPV >= 1 && multiPV <= core.MaxMultiPV {
+			searcher.MultiPV = multiPV
+		}
+	case "contempt":
+		if contempt, err := strconv.Atoi(value); err == nil && contempt >= -core.MaxContempt && contempt <= core.MaxContempt {
+			searcher.Contempt = contempt
+		}
+	case "threads":
+		if threads, err := strconv.Atoi(value); err == nil && threads >= 1 && threads <= core.MaxThreads {
+			searcher.Threads = threads
+		}
+	case "hash":
+		if sizeInMB, err := strconv.Atoi(value); err == nil {
+			searcher.ResizeTT(sizeInMB)
+		}
+	}
+}
+
 func isreadyCommandResponse(board *core.Board) {
 	board.LoadFEN(core.FENStartPosition)
 	fmt.Printf("readyok\n")
@@ -36,18 +142,30 @@ func positionCommandResponse(searcher *core.Searcher, command string) {
 		args = strings.TrimPrefix(args, "startpos ")
 		fenString = core.FENStartPosition
 	} else if strings.HasPrefix(args, "fen") {
+		// The FEN string is everything up to the list of moves, if
+		// there is one.
 		args = strings.TrimPrefix(args, "fen ")
-		remaining_args := strings.Fields(args)
-		fenString = strings.Join(remaining_args[0:6], " ")
-		args = strings.Join(remaining_args[6:], " ")
+		fenString = args
+		args = ""
+		if movesIndex := strings.Index(fenString, "moves"); movesIndex != -1 {
+			fenString, args = fenString[:movesIndex], fenString[movesIndex:]
+		}
 	}
 
-	searcher.Board.LoadFEN(fenString)
+	// Don't crash if the GUI sends us a bad position, just
+	// let it know and keep the current position.
+	if err := searcher.Board.LoadFEN(strings.TrimSpace(fenString)); err != nil {
+		fmt.Printf("info string %v\n", err)
+		return
+	}
+
+	// The state of each move is saved, so the search can tell when a
+	// position repeats one from earlier in the game.
 	if strings.HasPrefix(args, "moves") {
 		args = strings.TrimPrefix(args, "moves ")
 		for _, moveAsString := range strings.Fields(args) {
 			move := core.ConvertLongAlgebraicNotationToMove(&searcher.Board, moveAsString)
-			searcher.Board.DoMove(&move, false)
+			searcher.Board.DoMove(&move, true)
 		}
 	}
 }
@@ -66,39 +184,107 @@ func getBookMove(board *core.Board, openingBook *map[uint64]PolyglotEntry) strin
 	return ""
 }
 
-func getTimeLeftInGame(whiteToMove bool, command string) int64 {
+// Get the value of an integer argument of the go command, such as
+// "depth 6" or "movetime 1000". Zero is returned if the argument isn't
+// given or isn't a non-negative integer.
+func getGoArgument(command, name string) int64 {
 	fields := strings.Fields(command)
 	for index, field := range fields {
-		if strings.HasPrefix(field, "wtime") && whiteToMove {
-			timeAsStr := fields[index+1]
-			time, err := strconv.Atoi(timeAsStr)
-			if err != nil {
-				break
-			}
-			return int64(time)
-		} else if strings.HasPrefix(field, "btime") && !whiteToMove {
-			timeAsStr := fields[index+1]
-			time, err := strconv.Atoi(timeAsStr)
-			if err != nil {
+		if field == name && index+1 < len(fields) {
+			value, err := strconv.ParseInt(fields[index+1], 10, 64)
+			if err != nil || value < 0 {
 				break
 			}
-			return int64(time)
+			return value
+		}
+	}
+	return 0
+}
+
+// Determine whether the go command has the given argument without a value,
+// such as "infinite" or "ponder".
+func hasGoFlag(command, name string) bool {
+	for _, field := range strings.Fields(command) {
+		if field == name {
+			return true
 		}
 	}
-	// If not time is given, assume we have enough time to do a full search
-	return core.TimeThreshHoldForBulletPlay + 1
+	return false
+}
+
+// Get the move to play if the search fails, which is the first legal move,
+// or a null move if there are none.
+func getFallbackMove(board *core.Board) string {
+	var moves []uint16
+	core.GenLegalMoves(board, &moves)
+	if len(moves) == 0 {
+		return "0000"
+	}
+	return core.ConvertMoveToLongAlgebraicNotation(moves[0])
 }
 
-func goCommandResponse(searcher *core.Searcher, openingBoook map[uint64]PolyglotEntry, command string) {
+func goCommandResponse(searcher *core.Searcher, book *OpeningBook, command string) {
+	// The search runs in its own goroutine, so if a bug makes it panic, the
+	// whole engine would go down with it, dropping the connection to the
+	// GUI. Instead, log the panic along with the position it happened in,
+	// put the board back the way it was, and play the first legal move.
+	root := searcher.Board.Copy()
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("search panicked in position %v: %v\n%s", root.ToFEN(), err, debug.Stack())
+			searcher.Board = root
+			fmt.Printf("bestmove %v\n", getFallbackMove(&searcher.Board))
+		}
+	}()
+
 	command = strings.TrimPrefix(command, "go ")
-	if bookMove := getBookMove(&searcher.Board, &openingBoook); bookMove != "" && searcher.BookMovesLeft > 0 {
+	timeName, incrementName := "wtime", "winc"
+	if !searcher.Board.WhiteToMove {
+		timeName, incrementName = "btime", "binc"
+	}
+
+	limits := core.SearchLimits{
+		TimeLeft:  getGoArgument(command, timeName),
+		Increment: getGoArgument(command, incrementName),
+		MovesToGo: int(getGoArgument(command, "movestogo")),
+		MateIn:    int(getGoArgument(command, "mate")),
+		Depth:     int(getGoArgument(command, "depth")),
+		Nodes:     uint64(getGoArgument(command, "nodes")),
+		MoveTime:  getGoArgument(command, "movetime"),
+		Infinite:  hasGoFlag(command, "infinite"),
+	}
+
+	// Don't use the book when asked to solve for a mate, or when we have
+	// to keep searching until the GUI tells us to stop.
+	bookMove := ""
+	if book.Enabled && searcher.BookMovesLeft > 0 && limits.MateIn == 0 &&
+		!limits.Infinite && !hasGoFlag(command, "ponder") {
+		bookMove = getBookMove(&searcher.Board, &book.Entries)
+	}
+
+	if bookMove != "" {
 		time.Sleep(time.Second * BookMoveTimeDelay)
 		fmt.Printf("bestmove %v\n", bookMove)
 		searcher.BookMovesLeft--
 	} else {
-		bestMove := searcher.Search(getTimeLeftInGame(searcher.Board.WhiteToMove, command))
+		bestMove := searcher.Search(limits)
 		if bestMove == core.NullMove {
-			panic("nullmove encountered")
+			// There are no legal moves, so the game is already over. UCI
+			// uses 0000 for a null move.
+			if searcher.Board.IsCheckmate() {
+				fmt.Printf("info string no legal moves: checkmate\n")
+			} else {
+				fmt.Printf("info string no legal moves: stalemate\n")
+			}
+			fmt.Printf("bestmove 0000\n")
+			return
+		}
+		// Let the GUI know the reply we expect, so it can tell us to
+		// ponder on it while the opponent thinks.
+		if ponderMove := searcher.PonderMove(); ponderMove != core.NullMove {
+			fmt.Printf("bestmove %v ponder %v\n", core.ConvertMoveToLongAlgebraicNotation(bestMove),
+				core.ConvertMoveToLongAlgebraicNotation(ponderMove))
+			return
 		}
 		fmt.Printf("bestmove %v\n", core.ConvertMoveToLongAlgebraicNotation(bestMove))
 	}
@@ -112,31 +298,75 @@ func printCommandResponse() {
 	// print internal engine info
 }
 
+// Respond to the non-standard commands "perft <fen> <depth>" and "divide
+// <fen> <depth>", which run perft on the given position (or "startpos"),
+// to help debug the move generator against other engines.
+func perftCommandResponse(command string) {
+	fields := strings.Fields(command)
+	if len(fields) < 3 {
+		fmt.Printf("info string usage: %v <fen | startpos> <depth>\n", fields[0])
+		return
+	}
+
+	depth, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || depth < 1 {
+		fmt.Printf("info string invalid perft depth: %v\n", fields[len(fields)-1])
+		return
+	}
+
+	fen := strings.Join(fields[1:len(fields)-1], " ")
+	if fen == "startpos" {
+		fen = core.FENStartPosition
+	}
+
+	var board core.Board
+	if err := board.LoadFEN(fen); err != nil {
+		fmt.Printf("info string %v\n", err)
+		return
+	}
+
+	ttable := new([core.TTPerftSize]core.PerftTTEntry)
+	if fields[0] == "divide" {
+		core.DividePerft(&board, depth, ttable)
+	} else {
+		core.Perft(&board, depth, ttable)
+	}
+}
+
+// Respond to the non-standard command "bench [depth]", which searches a
+// fixed set of positions to the given depth (or core.BenchDepth), and
+// reports the total number of nodes searched and the nodes per second.
+func benchCommandResponse(command string) {
+	depth := core.BenchDepth
+	if fields := strings.Fields(command); len(fields) > 1 {
+		var err error
+		if depth, err = strconv.Atoi(fields[1]); err != nil || depth < 1 {
+			fmt.Printf("info string invalid bench depth: %v\n", fields[1])
+			return
+		}
+	}
+	core.Bench(depth)
+}
+
 func RunUCIProtocol() {
 	reader := bufio.NewReader(os.Stdin)
 	var searcher core.Searcher
 	searcher.Init()
 
-	// If we can't find our opening book, we're not in the best
-	// situation, but we can play without it, so don't make the
-	// program crash. Make an empty opening book and move on.
-	openingBook := make(map[uint64]PolyglotEntry)
-	filePath, err := os.Getwd()
+	book := OpeningBook{Enabled: true}
+	book.Load(defaultBookPath())
 
-	if err == nil {
-		openingBook, err = LoadPolyglotFile(filepath.Join(filePath, "book.bin"))
-		if err != nil {
-			log.Println("Loading opening book failed")
-		}
-	} else {
-		log.Println("Loading opening book failed")
-	}
+	// When debug mode is turned on by the GUI, commands the engine
+	// doesn't understand are reported back, to help debug the connection,
+	// and the search reports extra statistics (see Searcher.Debug).
+	debugMode := false
 
 	isReadyAlreadySent := false
 	for {
 		command, _ := reader.ReadString('\n')
+
 		if command == "uci\n" {
-			uciCommandResponse()
+			uciCommandResponse(&book)
 		} else if command == "isready\n" {
 			if !isReadyAlreadySent {
 				isreadyCommandResponse(&searcher.Board)
@@ -145,21 +375,33 @@ func RunUCIProtocol() {
 				fmt.Printf("readyok\n")
 			}
 		} else if strings.HasPrefix(command, "setoption") {
-			// ignore
-			// set internal engine options
+			setoptionCommandResponse(&searcher, &book, command)
 		} else if strings.HasPrefix(command, "ucinewgame") {
 			searcher.Init()
 		} else if strings.HasPrefix(command, "position") {
 			positionCommandResponse(&searcher, command)
 		} else if strings.HasPrefix(command, "go") {
-			go goCommandResponse(&searcher, openingBook, command)
+			searcher.ClearStop()
+			searcher.SetPondering(hasGoFlag(command, "ponder"))
+			go goCommandResponse(&searcher, &book, command)
 		} else if strings.HasPrefix(command, "stop") {
-			searcher.StopSearch = true
+			searcher.Stop()
+		} else if strings.HasPrefix(command, "ponderhit") {
+			searcher.PonderHit()
 		} else if command == "quit\n" {
 			quitCommandResponse()
 			break
 		} else if command == "print\n" {
 			printCommandResponse()
+		} else if strings.HasPrefix(command, "perft") || strings.HasPrefix(command, "divide") {
+			perftCommandResponse(command)
+		} else if strings.HasPrefix(command, "bench") {
+			benchCommandResponse(command)
+		} else if strings.HasPrefix(command, "debug") {
+			debugMode = strings.TrimSpace(strings.TrimPrefix(command, "debug")) == "on"
+			searcher.Debug = debugMode
+		} else if debugMode && strings.TrimSpace(command) != "" {
+			fmt.Printf("info string unknown command: %v\n", strings.TrimSpace(command))
 		}
 	}
 }
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"blunder/core"
+	"strings"
+	"testing"
+)
+
+// Positions to test attack maps in, along with the color whose attacks are
+// computed and the squares it should attack. Pieces of either color block
+// sliding pieces, but the squares they're on are still attacked.
+var AttackMapTestPositions = []struct {
+	FEN     string
+	Color   int
+	Squares string
+}{
+	{core.FENStartPosition, core.WhiteBB, "b1 c1 d1 e1 f1 g1 a2 b2 c2 d2 e2 f2 g2 h2 a3 b3 c3 d3 e3 f3 g3 h3"},
+	{core.FENStartPosition, core.BlackBB, "b8 c8 d8 e8 f8 g8 a7 b7 c7 d7 e7 f7 g7 h7 a6 b6 c6 d6 e6 f6 g6 h6"},
+	{"4k3/8/8/8/8/8/P6P/R3K3 w - - 0 1", core.WhiteBB, "a2 b1 c1 d1 e1 f1 d2 e2 f2 b3 g3"},
+	{"4k3/8/8/8/8/8/P6P/R3K3 w - - 0 1", core.BlackBB, "d8 f8 d7 e7 f7"},
+}
+
+// To ensure attack maps are computed correctly, check the squares attacked
+// by the given color in each test position, square by square.
+func TestAttackMap(t *testing.T) {
+	var board core.Board
+	for _, position := range AttackMapTestPositions {
+		board.LoadFEN(position.FEN)
+		var expectedBB uint64
+		for _, coordinate := range strings.Fields(position.Squares) {
+			expectedBB |= core.Int64MostSigBitSet >> core.CoordinateToPos(coordinate)
+		}
+		if attacksBB := core.AttackMap(&board, position.Color); attacksBB != expectedBB {
+			t.Errorf("computing the attack map in %v failed, got 0x%x, but expected 0x%x",
+				position.FEN, attacksBB, expectedBB)
+		}
+	}
+}
+
+// Positions to test finding the pieces giving check in, with no check, a
+// single check by a rook or a pawn, and a double check by a rook and a
+// knight, along with the squares of the pieces giving check. Black is to
+// move in each of them.
+var CheckersTestPositions = []struct {
+	FEN      string
+	Checkers string
+}{
+	{core.FENStartPosition, ""},
+	{"4k3/8/8/8/8/8/8/4R1K1 b - - 0 1", "e1"},
+	{"4k3/3P4/8/8/8/8/8/6K1 b - - 0 1", "d7"},
+	{"4k3/8/3N4/8/8/8/8/4R1K1 b - - 0 1", "d6 e1"},
+}
+
+// To ensure the checkers are found correctly, check the pieces giving check
+// in each test position, and whether it's a double check. In a double check,
+// the move generator should only give king moves, since blocking or capturing
+// can only deal with one of the checkers.
+func TestCheckers(t *testing.T) {
+	var board core.Board
+	for _, position := range CheckersTestPositions {
+		board.LoadFEN(position.FEN)
+		var expectedBB uint64
+		squares := strings.Fields(position.Checkers)
+		for _, coordinate := range squares {
+			expectedBB |= core.Int64MostSigBitSet >> core.CoordinateToPos(coordinate)
+		}
+		if checkersBB := board.CheckersBB(); checkersBB != expectedBB {
+			t.Errorf("finding the checkers in %v failed, got 0x%x, but expected 0x%x",
+				position.FEN, checkersBB, expectedBB)
+		}
+
+		doubleCheck := len(squares) > 1
+		if board.IsDoubleCheck() != doubleCheck {
+			t.Errorf("expected double check to be %v in %v", doubleCheck, position.FEN)
+		}
+		if !doubleCheck {
+			continue
+		}
+		var moves []uint16
+		core.GenLegalMoves(&board, &moves)
+		for _, move := range moves {
+			if from, _, _ := core.GetMoveInfo(move); from != board.KingSq[core.BlackBB] {
+				t.Errorf("expected only king moves in double check in %v, got %v",
+					position.FEN, core.ConvertMoveToLongAlgebraicNotation(move))
+			}
+		}
+	}
+}
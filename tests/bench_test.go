@@ -0,0 +1,22 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// The depth the bench is run to by the bench tests, which is kept shallow
+// so the tests run quickly.
+const BenchTestDepth = 4
+
+// The node count of the bench is meant to be a signature of the search, so
+// running it twice should always search exactly the same number of nodes.
+func TestBenchIsDeterministic(t *testing.T) {
+	first := core.Bench(BenchTestDepth)
+	if first == 0 {
+		t.Fatalf("running the bench searched no nodes")
+	}
+	if second := core.Bench(BenchTestDepth); second != first {
+		t.Fatalf("running the bench twice searched different numbers of nodes: %d and %d", first, second)
+	}
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// The Zobrist hash of the starting position, as given by polyglot.
+const StartingPositionHash uint64 = 0x463b96181691fc9c
+
+// The number of plies played by the long game test, which is more than
+// the undo stack used to be able to hold.
+const LongGamePlies = 300
+
+// To ensure long games can't overflow the stack of undo information, shuffle
+// the knights back and forth from the starting position for longer than any
+// fixed-size stack would hold, and then undo every move. Every four plies the
+// position repeats, and once all of the moves are undone, the board should be
+// back to the starting position.
+func TestLongGame(t *testing.T) {
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+
+	var moves []uint16
+	for ply := 0; ply < LongGamePlies; ply++ {
+		moveAsString := []string{"g1f3", "g8f6", "f3g1", "f6g8"}[ply%4]
+		move := core.ConvertLongAlgebraicNotationToMove(&board, moveAsString)
+		board.DoMove(&move, true)
+		moves = append(moves, move)
+		if ply%4 == 3 && board.Hash != StartingPositionHash {
+			t.Fatalf("expected the starting position after %d plies, got hash 0x%x", ply+1, board.Hash)
+		}
+	}
+
+	for index := len(moves) - 1; index >= 0; index-- {
+		board.UndoMove(&moves[index])
+	}
+	if fen := board.ToFEN(); fen != core.FENStartPosition || board.Hash != StartingPositionHash {
+		t.Errorf("undoing a long game failed, got %v (hash 0x%x)", fen, board.Hash)
+	}
+}
+
+// A copy of a board should be independent of the original, so playing and
+// undoing moves on the copy, even more moves than the original has ever had
+// played, shouldn't change the original or its stack of undo information.
+func TestBoardCopy(t *testing.T) {
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+	e4 := core.ConvertLongAlgebraicNotationToMove(&board, "e2e4")
+	board.DoMove(&e4, true)
+	fen, hash := board.ToFEN(), board.Hash
+
+	copied := board.Copy()
+	var moves []uint16
+	for ply := 0; ply < LongGamePlies; ply++ {
+		moveAsString := []string{"g8f6", "g1f3", "f6g8", "f3g1"}[ply%4]
+		move := core.ConvertLongAlgebraicNotationToMove(&copied, moveAsString)
+		copied.DoMove(&move, true)
+		moves = append(moves, move)
+	}
+	if board.ToFEN() != fen || board.Hash != hash {
+		t.Errorf("playing moves on a copy changed the original board, got %v", board.ToFEN())
+	}
+	for index := len(moves) - 1; index >= 0; index-- {
+		copied.UndoMove(&moves[index])
+	}
+	if copied.ToFEN() != fen || copied.Hash != hash {
+		t.Errorf("undoing moves on a copy failed, got %v", copied.ToFEN())
+	}
+
+	// Undoing the move played before copying the board should still work
+	// on both boards.
+	board.UndoMove(&e4)
+	copied.UndoMove(&e4)
+	if board.ToFEN() != core.FENStartPosition || copied.ToFEN() != core.FENStartPosition {
+		t.Errorf("undoing a move made before copying failed, got %v and %v", board.ToFEN(), copied.ToFEN())
+	}
+}
+
+// Positions to test checkmate and stalemate detection in, along with
+// whether the side to move is checkmated or stalemated. In the last two,
+// the side to move still has legal moves, first out of check and then in it.
+var GameOverTestPositions = []struct {
+	FEN         string
+	IsCheckmate bool
+	IsStalemate bool
+}{
+	{"7k/6Q1/6K1/8/8/8/8/8 b - - 0 1", true, false},
+	{"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", true, false},
+	{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", false, true},
+	{"k7/P7/K7/8/8/8/8/8 b - - 0 1", false, true},
+	{"7k/8/6K1/8/8/8/8/6Q1 b - - 0 1", false, false},
+	{"k7/8/1K6/8/8/8/8/R7 b - - 0 1", false, false},
+}
+
+// To ensure the end of the game is detected correctly, check whether the
+// side to move is checkmated or stalemated in each test position.
+func TestGameOverDetection(t *testing.T) {
+	var board core.Board
+	for _, position := range GameOverTestPositions {
+		board.LoadFEN(position.FEN)
+		if board.IsCheckmate() != position.IsCheckmate || board.IsStalemate() != position.IsStalemate {
+			t.Errorf("detecting the end of the game in %v failed, got checkmate %v and stalemate %v",
+				position.FEN, board.IsCheckmate(), board.IsStalemate())
+		}
+	}
+}
+
+// To ensure pieces are read correctly from the board, check the type and
+// color of a few pieces in the starting position, and that an empty square
+// is reported as unoccupied.
+func TestPieceAt(t *testing.T) {
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+	for _, test := range []struct {
+		Coordinate string
+		PieceType  int
+		Color      int
+	}{
+		{"e1", core.KingBB, core.WhiteBB},
+		{"d8", core.QueenBB, core.BlackBB},
+		{"b1", core.KnightBB, core.WhiteBB},
+		{"h7", core.PawnBB, core.BlackBB},
+	} {
+		pieceType, color, occupied := board.PieceAt(core.CoordinateToPos(test.Coordinate))
+		if !occupied || pieceType != test.PieceType || color != test.Color {
+			t.Errorf("reading the piece on %v failed, got type %d and color %d", test.Coordinate, pieceType, color)
+		}
+	}
+	if _, _, occupied := board.PieceAt(core.CoordinateToPos("e4")); occupied {
+		t.Errorf("reading the piece on e4 failed, expected it to be empty")
+	}
+}
+
+// Positions to test endgame detection in, along with whether they're an
+// endgame. The endgame is reached once the non-pawn material left is about
+// a rook and a minor piece each, whatever the number of pawns.
+var EndgameTestPositions = []struct {
+	FEN       string
+	IsEndgame bool
+}{
+	{core.FENStartPosition, false},
+	{core.FENKiwiPete, false},
+	{"3qk3/pppppppp/8/8/8/8/PPPPPPPP/3QK3 w - - 0 1", false},
+	{"1n1rk3/pppppppp/8/8/8/8/PPPPPPPP/1N1RK3 w - - 0 1", true},
+	{"8/8/4k3/8/8/4P3/4K3/8 w - - 0 1", true},
+}
+
+// To ensure the evaluation switches into its endgame mode at the right
+// time, check whether each test position is detected as an endgame.
+func TestIsEndgame(t *testing.T) {
+	var board core.Board
+	for _, position := range EndgameTestPositions {
+		board.LoadFEN(position.FEN)
+		if isEndgame := board.IsEndgame(); isEndgame != position.IsEndgame {
+			t.Errorf("detecting the endgame in %v failed, got %v (phase %d)", position.FEN, isEndgame, board.Phase())
+		}
+	}
+}
+
+// The phase of the game should start out at its maximum, with all of the
+// non-pawn material on the board, and reach zero once only the kings are
+// left.
+func TestPhase(t *testing.T) {
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+	if phase := board.Phase(); phase != core.MaxPhase {
+		t.Errorf("expected the phase of the start position to be %d, got %d", core.MaxPhase, phase)
+	}
+	board.LoadFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if phase := board.Phase(); phase != 0 {
+		t.Errorf("expected the phase with only the kings left to be 0, got %d", phase)
+	}
+}
+
+// Shuffling the knights out and back repeats the position they started
+// from, whichever side has the move, even after a pawn move, which only
+// stops the positions before it from being repeated.
+func TestRepetition(t *testing.T) {
+	var board core.Board
+	for _, test := range []struct {
+		Moves        []string
+		IsRepetition bool
+	}{
+		{[]string{"g1f3", "g8f6"}, false},
+		{[]string{"g1f3", "g8f6", "f3g1", "f6g8"}, true},
+		{[]string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3"}, true},
+		{[]string{"g1f3", "g8f6", "f3g1", "f6g8", "e2e4", "g8f6", "g1f3", "f6g8", "f3g1"}, true},
+		{[]string{"g1f3", "g8f6", "f3g1", "f6g8", "e2e4", "g8f6", "g1f3"}, false},
+	} {
+		board.LoadFEN(core.FENStartPosition)
+		for _, moveAsString := range test.Moves {
+			move := core.ConvertLongAlgebraicNotationToMove(&board, moveAsString)
+			board.DoMove(&move, true)
+		}
+		if isRepetition := board.IsRepetition(); isRepetition != test.IsRepetition {
+			t.Errorf("detecting a repetition after %v failed, got %v", test.Moves, isRepetition)
+		}
+	}
+}
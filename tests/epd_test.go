@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// Verify that EPD lines are parsed correctly, including their moves in SAN,
+// quoted operands, and the half move clock and full move number opcodes.
+func TestEPDParsing(t *testing.T) {
+	epdTest, err := ParseEPD("2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id \"WAC.001\";")
+	if err != nil {
+		t.Fatalf("parsing epd failed: %v", err)
+	}
+	if epdTest.ID != "WAC.001" || epdTest.FEN != "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1" ||
+		len(epdTest.BestMoves) != 1 || core.ConvertMoveToLongAlgebraicNotation(epdTest.BestMoves[0]) != "g3g6" {
+		t.Errorf("parsing epd failed, got %+v", epdTest)
+	}
+
+	epdTest, err = ParseEPD("6k1/5ppp/8/8/8/8/8/R5K1 w - - am Ra2 Ra3; c0 \"a comment; with a semicolon\"; hmvc 4; fmvn 40;")
+	if err != nil {
+		t.Fatalf("parsing epd failed: %v", err)
+	}
+	if epdTest.FEN != "6k1/5ppp/8/8/8/8/8/R5K1 w - - 4 40" || len(epdTest.AvoidMoves) != 2 ||
+		epdTest.Operations["c0"] != "\"a comment; with a semicolon\"" {
+		t.Fatalf("parsing epd failed, got %+v", epdTest)
+	}
+	var board core.Board
+	board.LoadFEN(epdTest.FEN)
+	ra8 := core.ConvertLongAlgebraicNotationToMove(&board, "a1a8")
+	if !epdTest.IsSolvedBy(ra8) || epdTest.IsSolvedBy(epdTest.AvoidMoves[0]) {
+		t.Errorf("checking epd solutions failed")
+	}
+
+	if _, err := ParseEPD("6k1/5ppp/8/8/8/8/8/R5K1 w - - bm Ra9;"); err == nil {
+		t.Errorf("parsing epd failed: expected an error for an invalid best move")
+	}
+}
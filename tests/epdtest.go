@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"blunder/core"
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A position from an EPD test suite, such as WAC. Each position comes with
+// a list of operations, given by an opcode and its operands. The best moves
+// (bm) the engine should find and the moves it should avoid (am) are given
+// in SAN, and they're parsed into moves when the position is parsed. Any
+// other operations are kept as they were written.
+type EPDTest struct {
+	FEN        string
+	ID         string
+	BestMoves  []uint16
+	AvoidMoves []uint16
+	Operations map[string]string
+}
+
+// Parse a line of an EPD file. An EPD line has the first four fields of a
+// FEN string, followed by operations separated by semicolons, such as
+// `bm Qg6; id "WAC.001";`. The half move clock and full move number can be
+// given by the hmvc and fmvn opcodes, and otherwise default to 0 and 1.
+func ParseEPD(line string) (EPDTest, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return EPDTest{}, fmt.Errorf("invalid epd \"%v\": expected at least four fields", line)
+	}
+
+	epdTest := EPDTest{Operations: make(map[string]string)}
+	for _, operation := range splitEPDOperations(strings.Join(fields[4:], " ")) {
+		opcodeAndOperands := strings.SplitN(operation, " ", 2)
+		opcode, operands := opcodeAndOperands[0], ""
+		if len(opcodeAndOperands) == 2 {
+			operands = strings.TrimSpace(opcodeAndOperands[1])
+		}
+		epdTest.Operations[opcode] = operands
+	}
+
+	halfMoveClock, fullMoveNumber := "0", "1"
+	if hmvc, ok := epdTest.Operations["hmvc"]; ok {
+		halfMoveClock = hmvc
+	}
+	if fmvn, ok := epdTest.Operations["fmvn"]; ok {
+		fullMoveNumber = fmvn
+	}
+	epdTest.FEN = strings.Join(append(fields[:4:4], halfMoveClock, fullMoveNumber), " ")
+	epdTest.ID = strings.Trim(epdTest.Operations["id"], "\"")
+
+	var board core.Board
+	if err := board.LoadFEN(epdTest.FEN); err != nil {
+		return EPDTest{}, fmt.Errorf("invalid epd \"%v\": %v", line, err)
+	}
+	for _, opcode := range []string{"bm", "am"} {
+		for _, san := range strings.Fields(epdTest.Operations[opcode]) {
+			move, err := core.SANToMove(&board, san)
+			if err != nil {
+				return EPDTest{}, fmt.Errorf("invalid epd \"%v\": %v", line, err)
+			}
+			if opcode == "bm" {
+				epdTest.BestMoves = append(epdTest.BestMoves, move)
+			} else {
+				epdTest.AvoidMoves = append(epdTest.AvoidMoves, move)
+			}
+		}
+	}
+	return epdTest, nil
+}
+
+// Split the operations of an EPD line on the semicolons ending them, except
+// for semicolons inside quoted strings, such as the operand of a comment.
+func splitEPDOperations(text string) (operations []string) {
+	inQuotes, start := false, 0
+	for index, char := range text {
+		if char == '"' {
+			inQuotes = !inQuotes
+		} else if char == ';' && !inQuotes {
+			if operation := strings.TrimSpace(text[start:index]); operation != "" {
+				operations = append(operations, operation)
+			}
+			start = index + 1
+		}
+	}
+	if operation := strings.TrimSpace(text[start:]); operation != "" {
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+// Determine if the move the engine chose solves an EPD test: it must be one
+// of the best moves, if any are given, and none of the moves to avoid.
+func (epdTest *EPDTest) IsSolvedBy(move uint16) bool {
+	for _, avoidMove := range epdTest.AvoidMoves {
+		if move == avoidMove {
+			return false
+		}
+	}
+	if len(epdTest.BestMoves) == 0 {
+		return true
+	}
+	for _, bestMove := range epdTest.BestMoves {
+		if move == bestMove {
+			return true
+		}
+	}
+	return false
+}
+
+// Run the EPD test suite in the given file, searching each position for the
+// given number of milliseconds, and report how many of the positions with
+// a best move or a move to avoid the engine solves.
+func RunEPDTests(filePath string, moveTime int64) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	var searcher core.Searcher
+	searcher.Init()
+
+	totalTests, solvedTests := 0, 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		epdTest, err := ParseEPD(line)
+		if err != nil {
+			panic(err)
+		}
+		if len(epdTest.BestMoves) == 0 && len(epdTest.AvoidMoves) == 0 {
+			continue
+		}
+
+		searcher.Init()
+		searcher.LoadFEN(epdTest.FEN)
+		board := searcher.Board.Copy()
+		bestMove, _, _ := searcher.SearchQuietly(core.SearchLimits{MoveTime: moveTime})
+
+		totalTests++
+		result := "failed"
+		if epdTest.IsSolvedBy(bestMove) {
+			solvedTests++
+			result = "solved"
+		}
+		fmt.Printf("%v: %v with %v (bm %v am %v)\n", epdTest.ID, result,
+			core.MoveToSAN(&board, bestMove), epdTest.Operations["bm"], epdTest.Operations["am"])
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("\nSummary of tests run:")
+	fmt.Printf("Out of %d tests, %d were solved\n", totalTests, solvedTests)
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"blunder/core"
+	"strings"
+	"testing"
+)
+
+// Get the static evaluation of a position, from the point of view of the
+// side to move.
+func staticEvalOf(fen string) int {
+	var board core.Board
+	board.LoadFEN(fen)
+	return core.Evaluate(&board)
+}
+
+// Get how much an evaluation term adds to the static evaluation of a
+// position, by evaluating it again with the term turned off. The term is
+// turned off by the given function, and turned back on afterwards.
+func evalTermOf(fen string, turnOff func(params *core.EvalParams)) int {
+	defaultParams := core.EvalParameters
+	defer func() { core.EvalParameters = defaultParams }()
+
+	withTerm := staticEvalOf(fen)
+	turnOff(&core.EvalParameters)
+	return withTerm - staticEvalOf(fen)
+}
+
+// White's rooks doubled on the open d-file, and the same two rooks on the
+// open d and e files.
+const (
+	DoubledRooksTestFEN = "4k3/pp3ppp/8/8/8/8/PP1R1PPP/3R2K1 w - - 0 1"
+	SplitRooksTestFEN   = "4k3/pp3ppp/8/8/8/8/PP3PPP/3RR1K1 w - - 0 1"
+)
+
+// Doubling the rooks on an open file should be worth exactly the doubled
+// rooks bonus more than keeping the same rooks on separate open files, once
+// everything else that's different between the positions is taken out.
+func TestDoubledRooks(t *testing.T) {
+	turnOff := func(params *core.EvalParams) { params.DoubledRooksBonus = 0 }
+	doubled := evalTermOf(DoubledRooksTestFEN, turnOff)
+	split := evalTermOf(SplitRooksTestFEN, turnOff)
+	if doubled-split != core.EvalParameters.DoubledRooksBonus {
+		t.Errorf("expected doubled rooks to be worth %d more than split rooks, got %d",
+			core.EvalParameters.DoubledRooksBonus, doubled-split)
+	}
+}
+
+// Rook endgames with a passed pawn, where the rook is either behind the
+// pawn or in front of it. The white rook is behind white's passed pawn in
+// the first pair, and behind black's, blockading it, in the second.
+var RookBehindPasserTests = []struct {
+	Behind, InFront string
+}{
+	{"8/7k/8/3P4/8/8/8/3R2K1 w - - 0 1", "3R4/7k/8/3P4/8/8/8/6K1 w - - 0 1"},
+	{"3R4/7k/8/8/3p4/8/8/6K1 w - - 0 1", "8/7k/8/8/3p4/8/8/3R2K1 w - - 0 1"},
+}
+
+// A rook behind a passed pawn, whether it's supporting a friendly pawn or
+// holding back an enemy one, should be evaluated higher than a rook in
+// front of it. Only the rook behind the pawn should get the bonus for it.
+func TestRookBehindPassedPawn(t *testing.T) {
+	bonuses := []int{core.EvalParameters.RookBehindPassedPawnBonus, core.EvalParameters.RookBehindEnemyPassedPawnBonus}
+	turnOff := func(params *core.EvalParams) {
+		params.RookBehindPassedPawnBonus = 0
+		params.RookBehindEnemyPassedPawnBonus = 0
+	}
+	for index, test := range RookBehindPasserTests {
+		if behind, inFront := staticEvalOf(test.Behind), staticEvalOf(test.InFront); behind <= inFront {
+			t.Errorf("expected a rook behind the passed pawn (%d) to be evaluated higher than in front of it (%d)", behind, inFront)
+		}
+		if bonus := evalTermOf(test.Behind, turnOff); bonus != bonuses[index] {
+			t.Errorf("expected a bonus of %d for the rook behind the passed pawn in %v, got %d", bonuses[index], test.Behind, bonus)
+		}
+		if bonus := evalTermOf(test.InFront, turnOff); bonus != 0 {
+			t.Errorf("expected no bonus for the rook in front of the passed pawn in %v, got %d", test.InFront, bonus)
+		}
+	}
+}
+
+// The same pieces with eight, four, and no pawns for each side. In the
+// first set, white has a knight against black's bishop, and in the second,
+// white has the bishop pair against black's two knights.
+var (
+	KnightImbalanceTestFENs = []string{
+		"6k1/pppppppp/2b5/8/8/2N5/PPPPPPPP/6K1 w - - 0 1",
+		"6k1/pppp4/2b5/8/8/2N5/PPPP4/6K1 w - - 0 1",
+		"6k1/8/2b5/8/8/2N5/8/6K1 w - - 0 1",
+	}
+	BishopPairImbalanceTestFENs = []string{
+		"6k1/pppppppp/2n2n2/8/8/2B2B2/PPPPPPPP/6K1 w - - 0 1",
+		"6k1/pppp4/2n2n2/8/8/2B2B2/PPPP4/6K1 w - - 0 1",
+		"6k1/8/2n2n2/8/8/2B2B2/8/6K1 w - - 0 1",
+	}
+)
+
+// Knights need pawns to support them, and bishops want open positions, so
+// as pawns are taken off the board, the material imbalance should favor a
+// knight less and less, and the bishop pair against two knights more and
+// more.
+func TestImbalance(t *testing.T) {
+	turnOff := func(params *core.EvalParams) { params.UseImbalance = false }
+	for index := 1; index < len(KnightImbalanceTestFENs); index++ {
+		morePawns := evalTermOf(KnightImbalanceTestFENs[index-1], turnOff)
+		fewerPawns := evalTermOf(KnightImbalanceTestFENs[index], turnOff)
+		if fewerPawns >= morePawns {
+			t.Errorf("expected the imbalance to favor the knight less with fewer pawns, got %d and then %d", morePawns, fewerPawns)
+		}
+	}
+	for index := 1; index < len(BishopPairImbalanceTestFENs); index++ {
+		morePawns := evalTermOf(BishopPairImbalanceTestFENs[index-1], turnOff)
+		fewerPawns := evalTermOf(BishopPairImbalanceTestFENs[index], turnOff)
+		if fewerPawns <= morePawns {
+			t.Errorf("expected the imbalance to favor the bishop pair more with fewer pawns, got %d and then %d", morePawns, fewerPawns)
+		}
+	}
+}
+
+// A position where white's pawns and knights dominate the center, while
+// black has only pushed its rook pawns.
+const CenterControlTestFEN = "rnbqkbnr/1pppppp1/p6p/8/3PP3/2N2N2/PPP2PPP/R1BQKB1R w KQkq - 0 1"
+
+// In a symmetric position, like the starting position, both sides control
+// the center equally, so the center control term should cancel out. In a
+// position where white dominates the center, it should favor white, whichever
+// side is to move.
+func TestCenterControl(t *testing.T) {
+	turnOff := func(params *core.EvalParams) {
+		params.CenterAttackBonus = 0
+		params.ExtendedCenterAttackBonus = 0
+		params.CenterOccupationBonus = 0
+	}
+	if score := evalTermOf(core.FENStartPosition, turnOff); score != 0 {
+		t.Errorf("expected center control to cancel out in the starting position, got %d", score)
+	}
+	if score := evalTermOf(CenterControlTestFEN, turnOff); score <= 0 {
+		t.Errorf("expected center control to favor white with white to move, got %d", score)
+	}
+	blackToMove := strings.Replace(CenterControlTestFEN, " w ", " b ", 1)
+	if score := evalTermOf(blackToMove, turnOff); score >= 0 {
+		t.Errorf("expected center control to favor white with black to move, got %d", score)
+	}
+}
+
+// Positions where only white has the bishop pair, where white has three
+// bishops after promoting to one, and where both sides have the pair.
+const (
+	BishopPairTestFEN      = "4k3/pppp1ppp/2n5/8/8/2B2B2/PPPP1PPP/4K3 w - - 0 1"
+	ThreeBishopsTestFEN    = "4k3/pppp1ppp/2n5/8/8/2BB1B2/PPP2PPP/4K3 w - - 0 1"
+	BothBishopPairsTestFEN = "4k3/pppp1ppp/2b2b2/8/8/2B2B2/PPPP1PPP/4K3 w - - 0 1"
+)
+
+// The bishop pair should be worth the same bonus to a side however many
+// bishops it has, and cancel out when both sides have it.
+func TestBishopPair(t *testing.T) {
+	bonus := core.EvalParameters.BishopPairBonus
+	turnOff := func(params *core.EvalParams) { params.BishopPairBonus = 0 }
+	for _, fen := range []string{BishopPairTestFEN, ThreeBishopsTestFEN} {
+		if score := evalTermOf(fen, turnOff); score != bonus {
+			t.Errorf("expected the bishop pair to be worth %d in %v, got %d", bonus, fen, score)
+		}
+	}
+	if score := evalTermOf(BothBishopPairsTestFEN, turnOff); score != 0 {
+		t.Errorf("expected the bishop pairs to cancel out, got %d", score)
+	}
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// To ensure FEN strings are exported correctly, load each position from
+// the perft suite, and verify that exporting it with ToFEN gives back the
+// exact FEN string it was loaded from.
+func TestFENRoundTrip(t *testing.T) {
+	perftTests, err := loadPerftSuite()
+	if err != nil {
+		t.Fatalf("loading the perft suite failed: %v", err)
+	}
+
+	var board core.Board
+	for _, perftTest := range perftTests {
+		board.LoadFEN(perftTest.FEN)
+		if fen := board.ToFEN(); fen != perftTest.FEN {
+			t.Errorf("exporting fen failed: expected \"%v\", but got \"%v\"", perftTest.FEN, fen)
+		}
+	}
+}
+
+// Verify that the half-move clock and full-move counter are parsed
+// correctly when they're more than a single digit long.
+func TestFENClockParsing(t *testing.T) {
+	var board core.Board
+	board.LoadFEN("8/8/8/8/8/8/8/K6k w - - 45 123")
+	if board.HalfMoveClock != 45 || board.FullMoveCounter != 123 {
+		t.Errorf("parsing fen clocks failed: expected 45 and 123, but got %v and %v",
+			board.HalfMoveClock, board.FullMoveCounter)
+	}
+}
+
+// Chess960 starting positions, with their castling rights given both as
+// Shredder-FEN file letters and as the classic KQkq letters, along with the
+// squares of the castling rooks, in the order of the castling rights.
+var Chess960CastlingTests = []struct {
+	FEN     string
+	RookSqs [4]int
+}{
+	{"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 0 1", [4]int{6, 4, 62, 60}},
+	{"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w KQkq - 0 1", [4]int{6, 4, 62, 60}},
+	{"rkrnnqbb/pppppppp/8/8/8/8/PPPPPPPP/RKRNNQBB w CAca - 0 1", [4]int{2, 0, 58, 56}},
+	{"rkrnnqbb/pppppppp/8/8/8/8/PPPPPPPP/RKRNNQBB w KQkq - 0 1", [4]int{2, 0, 58, 56}},
+	{"nrbbqkrn/pppppppp/8/8/8/8/PPPPPPPP/NRBBQKRN w GBgb - 0 1", [4]int{6, 1, 62, 57}},
+	{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1", [4]int{7, 0, 63, 56}},
+}
+
+// Verify that the castling rights of Chess960 starting positions are
+// parsed to the right rook squares, whether they're given in Shredder-FEN
+// file letters, or the classic KQkq letters.
+func TestChess960CastlingParsing(t *testing.T) {
+	var board core.Board
+	for _, castlingTest := range Chess960CastlingTests {
+		board.LoadFEN(castlingTest.FEN)
+		if board.CastlingRights != core.WhiteKingside|core.WhiteQueenside|core.BlackKingside|core.BlackQueenside ||
+			board.CastlingRookSqs != castlingTest.RookSqs {
+			t.Errorf("parsing castling rights of \"%v\" failed: expected rooks on %v, but got %v",
+				castlingTest.FEN, castlingTest.RookSqs, board.CastlingRookSqs)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !race
+// +build !race
+
+package tests
+
+// Without the race detector, the search runs at its normal speed.
+const raceEnabled = false
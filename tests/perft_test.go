@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// The transposition table shared by the perft tests. It's too big to put
+// on the stack, and the entries are keyed by the position, so they don't
+// need to be cleared between tests.
+var perftTT [core.TTPerftSize]core.PerftTTEntry
+
+// Verify the move generator by running perft on every position of the perft
+// suite, at every depth with a known node count. This takes a while, so it's
+// skipped in short mode.
+func TestPerftSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the perft suite in short mode")
+	}
+	perftTests, err := loadPerftSuite()
+	if err != nil {
+		t.Fatalf("loading the perft suite failed: %v", err)
+	}
+
+	var board core.Board
+	for _, perftTest := range perftTests {
+		for depth, nodeCount := range perftTest.DepthValues {
+			if nodeCount == 0 {
+				continue
+			}
+			board.LoadFEN(perftTest.FEN)
+			if result := core.RawPerft(&board, depth+1, &perftTT); result != nodeCount {
+				t.Errorf("wrong node count of %d at a depth of %d for %v, expected %d",
+					result, depth+1, perftTest.FEN, nodeCount)
+			}
+		}
+	}
+}
+
+// The node counts of positions full of sliding pieces, which are used to
+// check the sliding piece move generation, and how long it takes.
+var SliderPerftTests = []PerftTest{
+	{FEN: "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", DepthValues: [7]uint64{48, 2039, 97862, 4085603}},
+	{FEN: "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", DepthValues: [7]uint64{14, 191, 2812, 43238, 674624}},
+	{FEN: "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", DepthValues: [7]uint64{6, 264, 9467, 422333}},
+	{FEN: "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", DepthValues: [7]uint64{44, 1486, 62379, 2103487}},
+}
+
+// Verify the moves of sliding pieces, which are looked up in the magic
+// bitboard tables, by running perft on positions full of them. The table
+// is cleared before each search, so every node is really generated.
+func TestSliderPerft(t *testing.T) {
+	var board core.Board
+	for _, perftTest := range SliderPerftTests {
+		for depth, nodeCount := range perftTest.DepthValues {
+			if nodeCount == 0 {
+				continue
+			}
+			board.LoadFEN(perftTest.FEN)
+			perftTT = [core.TTPerftSize]core.PerftTTEntry{}
+			if result := core.RawPerft(&board, depth+1, &perftTT); result != nodeCount {
+				t.Errorf("wrong node count of %d at a depth of %d for %v, expected %d",
+					result, depth+1, perftTest.FEN, nodeCount)
+			}
+		}
+	}
+}
+
+// Benchmark the sliding piece move generation with perft, without the
+// transposition table, on the first slider perft position.
+func BenchmarkSliderPerft(b *testing.B) {
+	var board core.Board
+	for i := 0; i < b.N; i++ {
+		board.LoadFEN(SliderPerftTests[0].FEN)
+		perftTT = [core.TTPerftSize]core.PerftTTEntry{}
+		core.RawPerft(&board, 3, &perftTT)
+	}
+}
+
+// Perft results for a handful of Chess960 positions, taken from the
+// Chess960 perft results on the chess programming wiki. These positions
+// have castling rights with the king and rooks off of their usual squares.
+var Chess960PerftTests = []PerftTest{
+	{FEN: "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", DepthValues: [7]uint64{21, 528, 12189, 326672, 8146062}},
+	{FEN: "2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9", DepthValues: [7]uint64{21, 807, 18002, 667366, 16253601}},
+	{FEN: "b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9", DepthValues: [7]uint64{20, 479, 10471, 273318, 6417013}},
+	{FEN: "qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9", DepthValues: [7]uint64{22, 593, 13440, 382958, 9183776}},
+	{FEN: "1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9", DepthValues: [7]uint64{28, 1120, 31058, 1171749, 34030312}},
+	{FEN: "qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w HEhe - 1 9", DepthValues: [7]uint64{29, 899, 26578, 824055}},
+}
+
+// Verify the move generator's Chess960 castling by running perft on each
+// of the Chess960 positions above, and checking the node counts. The table
+// is cleared first, so no entries from standard chess positions are used.
+func TestChess960Perft(t *testing.T) {
+	var board core.Board
+	board.Chess960 = true
+	perftTT = [core.TTPerftSize]core.PerftTTEntry{}
+	for _, perftTest := range Chess960PerftTests {
+		for depth, nodeCount := range perftTest.DepthValues {
+			if nodeCount == 0 {
+				continue
+			}
+			board.LoadFEN(perftTest.FEN)
+			if result := core.RawPerft(&board, depth+1, &perftTT); result != nodeCount {
+				t.Errorf("wrong node count of %d at a depth of %d for %v, expected %d",
+					result, depth+1, perftTest.FEN, nodeCount)
+			}
+		}
+	}
+}
+
+// The published breakdowns of the leaf nodes of perft for the starting
+// position, kiwipete, and a sparse endgame position, at each depth.
+var DetailedPerftTests = []struct {
+	FEN     string
+	Results []core.PerftResults
+}{
+	{core.FENStartPosition, []core.PerftResults{
+		{Nodes: 20},
+		{Nodes: 400},
+		{Nodes: 8902, Captures: 34, Checks: 12},
+		{Nodes: 197281, Captures: 1576, Checks: 469, Checkmates: 8},
+		{Nodes: 4865609, Captures: 82719, EnPassant: 258, Checks: 27351, Checkmates: 347},
+	}},
+	{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []core.PerftResults{
+		{Nodes: 48, Captures: 8, Castles: 2},
+		{Nodes: 2039, Captures: 351, EnPassant: 1, Castles: 91, Checks: 3},
+		{Nodes: 97862, Captures: 17102, EnPassant: 45, Castles: 3162, Checks: 993, Checkmates: 1},
+		{Nodes: 4085603, Captures: 757163, EnPassant: 1929, Castles: 128013, Promotions: 15172, Checks: 25523, Checkmates: 43},
+	}},
+	{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []core.PerftResults{
+		{Nodes: 14, Captures: 1, Checks: 2},
+		{Nodes: 191, Captures: 14, Checks: 10},
+		{Nodes: 2812, Captures: 209, EnPassant: 2, Checks: 267},
+		{Nodes: 43238, Captures: 3348, EnPassant: 123, Checks: 1680, Checkmates: 17},
+		{Nodes: 674624, Captures: 52051, EnPassant: 1165, Checks: 52950},
+	}},
+}
+
+// Verify the breakdown of the leaf nodes of perft by the kind of move that
+// reached them against the published results, which catches bugs that
+// happen to leave the node count right.
+func TestDetailedPerft(t *testing.T) {
+	var board core.Board
+	for _, perftTest := range DetailedPerftTests {
+		for depth, expected := range perftTest.Results {
+			board.LoadFEN(perftTest.FEN)
+			if results := core.PerftDetailed(&board, depth+1); results != expected {
+				t.Errorf("wrong perft results at a depth of %d for %v, got %+v, expected %+v",
+					depth+1, perftTest.FEN, results, expected)
+			}
+		}
+	}
+}
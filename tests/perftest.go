@@ -1,32 +1,30 @@
 package tests
 
 import (
-	"blunder/core"
 	"bufio"
+	_ "embed"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-const DepthLimit = 6
+// The perft suite, embedded in the package, so the tests that use it don't
+// depend on the directory they're run from.
+//
+//go:embed testdata/perftsuite.epd
+var perftSuite string
 
+// A position from the perft suite, along with its node counts at each depth.
+// A node count of zero means the depth isn't tested.
 type PerftTest struct {
 	FEN         string
 	DepthValues [7]uint64
 }
 
-func loadPerftSuite() (perftTests []PerftTest) {
-	home, _ := os.UserHomeDir()
-	filePath := filepath.Join(home, "goprojects/blunder/tests/perftsuite.epd")
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
-	}
-	reader := bufio.NewReader(file)
-	scanner := bufio.NewScanner(reader)
+// Load the positions of the perft suite. Each line of the suite is a FEN
+// string followed by the node counts at each depth, such as ";D1 20".
+func loadPerftSuite() (perftTests []PerftTest, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(perftSuite))
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -37,50 +35,16 @@ func loadPerftSuite() (perftTests []PerftTest) {
 		for _, nodeCountStr := range fields[1:] {
 			depth, err := strconv.Atoi(string(nodeCountStr[1]))
 			if err != nil {
-				panic(fmt.Sprintf("Parsing error on line: %s\n", line))
+				return nil, fmt.Errorf("parsing error on line: %s", line)
 			}
 			nodeCountStr = strings.TrimSpace(nodeCountStr[3:])
 			nodeCount, err := strconv.Atoi(nodeCountStr)
 			if err != nil {
-				panic(fmt.Sprintf("Parsing error on line: %s\n", line))
+				return nil, fmt.Errorf("parsing error on line: %s", line)
 			}
 			perftTest.DepthValues[depth-1] = uint64(nodeCount)
 		}
 		perftTests = append(perftTests, perftTest)
 	}
-	return perftTests
-}
-
-func RunPerftTests(board *core.Board, ttable *[core.TTPerftSize]core.PerftTTEntry) {
-	perftTests := loadPerftSuite()
-	totalTests := 0.0
-	correctTests := 0.0
-
-	for _, perftTest := range perftTests {
-		fmt.Println("Running perft on position:", perftTest.FEN)
-		board.LoadFEN(perftTest.FEN)
-		board.PrintBoard()
-		fmt.Println()
-
-		for depth, nodeCount := range perftTest.DepthValues {
-			if nodeCount == 0 {
-				continue
-			}
-
-			result := core.RawPerft(board, depth+1, ttable)
-			totalTests++
-			if nodeCount == result {
-				fmt.Println("Correct node count of", nodeCount, "at a depth of", depth+1)
-				correctTests++
-			} else {
-				fmt.Printf("Wrong node count at depth %d. Correct is %d, but Blunder got %d\n", depth+1,
-					nodeCount, result)
-			}
-			board.LoadFEN(perftTest.FEN)
-		}
-		fmt.Println()
-	}
-	fmt.Println("Summary of tests run:")
-	fmt.Printf("Out of %f tests, %f were correct, with a percentage of %f\n",
-		totalTests, correctTests, (correctTests/totalTests)*100)
+	return perftTests, scanner.Err()
 }
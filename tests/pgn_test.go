@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"blunder/core"
+	inter "blunder/interface"
+	"strings"
+	"testing"
+)
+
+// Verify that games are written as PGN correctly, both from the standard
+// starting position, and from a position given by a FEN string with black
+// to move. The movetext must also be wrapped.
+func TestPGN(t *testing.T) {
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+	var moves []uint16
+	for _, moveAsString := range []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1b5"} {
+		move := core.ConvertLongAlgebraicNotationToMove(&board, moveAsString)
+		board.DoMove(&move, true)
+		moves = append(moves, move)
+	}
+	board.LoadFEN(core.FENStartPosition)
+
+	pgn := inter.WritePGN(&board, moves, "1/2-1/2", inter.PGNTags{White: "Blunder", Black: "Blunder"})
+	expected := "[Event \"?\"]\n[Site \"?\"]\n[Date \"????.??.??\"]\n[Round \"?\"]\n" +
+		"[White \"Blunder\"]\n[Black \"Blunder\"]\n[Result \"1/2-1/2\"]\n\n" +
+		"1. e4 e5 2. Nf3 Nc6 3. Bb5 1/2-1/2\n"
+	if pgn != expected {
+		t.Errorf("writing pgn failed: expected\n%v\nbut got\n%v", expected, pgn)
+	}
+
+	fen := "6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 40"
+	board.LoadFEN(fen)
+	moves = moves[:0]
+	for _, moveAsString := range []string{"g8h8", "a1a8"} {
+		move := core.ConvertLongAlgebraicNotationToMove(&board, moveAsString)
+		board.DoMove(&move, true)
+		moves = append(moves, move)
+	}
+	board.LoadFEN(fen)
+
+	pgn = inter.WritePGN(&board, moves, "1-0", inter.PGNTags{})
+	if !strings.Contains(pgn, "[SetUp \"1\"]\n[FEN \""+fen+"\"]\n") || !strings.HasSuffix(pgn, "\n40... Kh8 41. Ra8# 1-0\n") {
+		t.Errorf("writing pgn from a fen failed, got\n%v", pgn)
+	}
+
+	// Shuffle the knights back and forth long enough for the movetext
+	// to need wrapping.
+	board.LoadFEN(core.FENStartPosition)
+	moves = moves[:0]
+	for index := 0; index < 40; index++ {
+		moveAsString := []string{"g1f3", "g8f6", "f3g1", "f6g8"}[index%4]
+		move := core.ConvertLongAlgebraicNotationToMove(&board, moveAsString)
+		board.DoMove(&move, true)
+		moves = append(moves, move)
+	}
+	board.LoadFEN(core.FENStartPosition)
+
+	pgn = inter.WritePGN(&board, moves, "", inter.PGNTags{})
+	for _, line := range strings.Split(pgn, "\n") {
+		if len(line) > inter.PGNLineWidth {
+			t.Errorf("writing pgn failed: line \"%v\" is too long", line)
+		}
+	}
+	if !strings.HasSuffix(pgn, " *\n") {
+		t.Errorf("writing pgn failed: expected an unknown result, got\n%v", pgn)
+	}
+}
+
+// Verify that PGN files are parsed correctly: comments, NAGs, and
+// variations are skipped, a FEN tag gives the starting position, and
+// a file can hold more than one game.
+func TestPGNParsing(t *testing.T) {
+	input := `[Event "Casual game"]
+[White "Blunder \"the engine\""]
+[Black "?"]
+[Result "1-0"]
+
+1. e4 {Best by test} e5 2. Nf3 $1 Nc6 (2... d6 3. d4 (3. Bc4 {the (Italian) way}) exd4)
+3.Bb5 a6 ; a line comment
+4. Bxc6 dxc6 5. O-O 1-0
+
+[Event "Endgame"]
+[SetUp "1"]
+[FEN "6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 40"]
+[Result "1-0"]
+
+40... Kh8 41. Ra8# 1-0
+`
+	games, err := inter.ParsePGN(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parsing pgn failed: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("parsing pgn failed: expected 2 games, got %d", len(games))
+	}
+
+	expected := [][]string{
+		{"e2e4", "e7e5", "g1f3", "b8c6", "f1b5", "a7a6", "b5c6", "d7c6", "e1g1"},
+		{"g8h8", "a1a8"},
+	}
+	for index, game := range games {
+		var moves []string
+		for _, move := range game.Moves {
+			moves = append(moves, core.ConvertMoveToLongAlgebraicNotation(move))
+		}
+		if strings.Join(moves, " ") != strings.Join(expected[index], " ") {
+			t.Errorf("parsing pgn failed: expected moves %v in game %d, got %v", expected[index], index+1, moves)
+		}
+		if game.Result != "1-0" {
+			t.Errorf("parsing pgn failed: expected result 1-0 in game %d, got %v", index+1, game.Result)
+		}
+	}
+	if games[0].Tags["White"] != "Blunder \"the engine\"" || games[0].StartFEN != core.FENStartPosition {
+		t.Errorf("parsing pgn failed: got tags %v and start position %v", games[0].Tags, games[0].StartFEN)
+	}
+	if games[1].StartFEN != "6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 40" {
+		t.Errorf("parsing pgn failed: expected the start position from the fen tag, got %v", games[1].StartFEN)
+	}
+
+	// A game written by WritePGN should be read back unchanged.
+	var board core.Board
+	board.LoadFEN(core.FENStartPosition)
+	pgn := inter.WritePGN(&board, games[0].Moves, games[0].Result, inter.PGNTags{})
+	written, err := inter.ParsePGN(strings.NewReader(pgn))
+	if err != nil || len(written) != 1 || len(written[0].Moves) != len(games[0].Moves) {
+		t.Errorf("parsing written pgn failed: %v\n%v", err, pgn)
+	}
+
+	if _, err := inter.ParsePGN(strings.NewReader("1. e4 e5 2. Ke3 *")); err == nil {
+		t.Errorf("parsing pgn failed: expected an error for an illegal move")
+	}
+}
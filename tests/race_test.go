@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package tests
+
+// Running the tests with the race detector (go test -race) makes the search
+// many times slower, so the tests which time it are skipped.
+const raceEnabled = true
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+)
+
+// A move given in long algebraic notation, and the SAN it should be
+// written as in the given position.
+type SANTest struct {
+	FEN  string
+	Move string
+	SAN  string
+}
+
+var sanTests = []SANTest{
+	{core.FENStartPosition, "g1f3", "Nf3"},
+	{core.FENStartPosition, "e2e4", "e4"},
+	{core.FENKiwiPete, "e5f7", "Nxf7"},
+	{core.FENKiwiPete, "d5e6", "dxe6"},
+	{core.FENKiwiPete, "e1g1", "O-O"},
+	{core.FENKiwiPete, "e1c1", "O-O-O"},
+	{"4k3/8/8/8/8/8/8/1N3N1K w - - 0 1", "b1d2", "Nbd2"},
+	{core.FENKiwiPete, "e2a6", "Bxa6"},
+	{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6"},
+	{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "a1d1", "Rad1"},
+	{"4k3/8/8/8/R7/8/8/R3K3 w - - 0 1", "a1a2", "R1a2"},
+	{"4k3/8/8/8/8/Q1Q5/8/Q1Q1K3 w - - 0 1", "c3b2", "Qc3b2"},
+	{"4k3/8/8/8/8/2Q1Q3/8/2Q1K3 w - - 0 1", "c3d4", "Qcd4+"},
+	{"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8#"},
+	{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8+"},
+	{"5n2/4P3/8/8/8/8/8/k3K3 w - - 0 1", "e7f8q", "exf8=Q"},
+	{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q", "a8=Q+"},
+	{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8n", "a8=N"},
+	{"r3k3/8/8/8/8/8/8/4K3 b q - 0 1", "e8c8", "O-O-O"},
+}
+
+// Verify that moves are written in SAN correctly, including disambiguation,
+// captures, castling, promotions, and check and checkmate suffixes.
+func TestSAN(t *testing.T) {
+	var board core.Board
+	for _, sanTest := range sanTests {
+		board.LoadFEN(sanTest.FEN)
+		move := core.ConvertLongAlgebraicNotationToMove(&board, sanTest.Move)
+		if san := core.MoveToSAN(&board, move); san != sanTest.SAN {
+			t.Errorf("writing %v in SAN failed: expected %v, but got %v", sanTest.Move, sanTest.SAN, san)
+		}
+	}
+}
+
+// Verify that moves given in SAN are parsed correctly, by parsing the SAN
+// of each of the SAN output tests, and a few ways of writing moves that
+// MoveToSAN doesn't use. Malformed, illegal, and ambiguous SAN must fail.
+func TestSANParsing(t *testing.T) {
+	var board core.Board
+	parsingTests := append([]SANTest{
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6e.p."},
+		{"4k3/8/8/8/8/8/8/1N3N1K w - - 0 1", "f1d2", "Nf1d2"},
+		{"5n2/4P3/8/8/8/8/8/k3K3 w - - 0 1", "e7f8n", "exf8N"},
+		{"r3k3/8/8/8/8/8/8/4K3 b q - 0 1", "e8c8", "0-0-0"},
+		{"5n1n/6Pk/8/8/8/8/8/4K3 w - - 0 1", "g7f8n", "gxf8=N+"},
+	}, sanTests...)
+
+	for _, sanTest := range parsingTests {
+		board.LoadFEN(sanTest.FEN)
+		move, err := core.SANToMove(&board, sanTest.SAN)
+		if err != nil || core.ConvertMoveToLongAlgebraicNotation(move) != sanTest.Move {
+			t.Errorf("parsing %v from SAN failed: expected %v, but got %v (%v)",
+				sanTest.SAN, sanTest.Move, core.ConvertMoveToLongAlgebraicNotation(move), err)
+		}
+	}
+
+	invalidTests := []SANTest{
+		{FEN: core.FENStartPosition, SAN: "e5"},
+		{FEN: core.FENStartPosition, SAN: "O-O"},
+		{FEN: core.FENStartPosition, SAN: "Nz3"},
+		{FEN: "4k3/8/8/8/8/8/8/1N3N1K w - - 0 1", SAN: "Nd2"},
+		{FEN: "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", SAN: "a8"},
+	}
+	for _, sanTest := range invalidTests {
+		board.LoadFEN(sanTest.FEN)
+		if _, err := core.SANToMove(&board, sanTest.SAN); err == nil {
+			t.Errorf("parsing %v from SAN should have failed", sanTest.SAN)
+		}
+	}
+}
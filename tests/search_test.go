@@ -0,0 +1,497 @@
+package tests
+
+import (
+	"blunder/core"
+	"testing"
+	"time"
+)
+
+// In this position, white is in check from the bishop on e6, and the only
+// legal move is c2c4, which blocks the check. The bishop can't capture the
+// pawn since it's pinned, but black can capture it en passant, which discovers
+// check from the bishop again, and this time it's checkmate.
+const QuiescenceEPTestFEN = "1r6/8/1R2b1k1/p4b2/N2p4/1K6/2P5/1n1n4 w - - 0 1"
+
+// To ensure the quiescence search considers en passant captures, search the
+// test position above to a depth of one, which leaves black's reply entirely
+// to the quiescence search. If the quiescence search is considering en passant
+// captures, it should find that white gets mated.
+func TestQuiescenceEP(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	searcher.LoadFEN(QuiescenceEPTestFEN)
+	if _, score, _ := searcher.SearchToDepth(1); score != core.NegInf+2 {
+		t.Errorf("the quiescence search didn't consider the en passant capture, got a score of %d", score)
+	}
+}
+
+// The start position is symmetric, so the only thing separating the two
+// sides is who has the move, and it should be evaluated slightly in favor
+// of the side to move, whichever side that is.
+func TestTempo(t *testing.T) {
+	var searcher core.Searcher
+	for _, fen := range []string{core.FENStartPosition, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"} {
+		searcher.LoadFEN(fen)
+		if score := searcher.StaticEval(); score != core.TempoBonus {
+			t.Errorf("expected the start position to be evaluated as %d for the side to move, got %d (%v)",
+				core.TempoBonus, score, fen)
+		}
+	}
+}
+
+// In a king and pawn versus king endgame, a pawn the enemy king can't catch
+// should be evaluated as much better than one it can.
+func TestKPKEndgame(t *testing.T) {
+	var searcher core.Searcher
+	searcher.LoadFEN("8/8/8/8/8/k7/6P1/K7 w - - 0 1")
+	unstoppable := searcher.StaticEval()
+	searcher.LoadFEN("8/8/8/6k1/8/8/6P1/K7 w - - 0 1")
+	stoppable := searcher.StaticEval()
+	if unstoppable <= stoppable+core.KPKUnstoppablePawnBonus/2 {
+		t.Errorf("expected an unstoppable pawn to be evaluated much higher, got %d and %d", unstoppable, stoppable)
+	}
+}
+
+// Positions with a king and rook against a lone king, with either side to
+// move and the rook on either side, the depth the engine searches each move
+// of the game to when playing them out, and the number of moves it should
+// take to mate. Mate can always be forced within sixteen moves, and the
+// engine shouldn't need many more than that, even searching this shallowly.
+var KRKTestFENs = []string{
+	"8/8/8/3k4/8/8/8/R3K3 w - - 0 1",
+	"8/8/8/4k3/8/8/8/4K2R b - - 0 1",
+	"7R/8/8/8/3k4/8/8/K7 w - - 0 1",
+	"8/1K6/8/8/8/4k3/8/7r w - - 0 1",
+	"8/8/3k4/8/3K4/8/8/R7 b - - 0 1",
+}
+
+const (
+	KRKTestDepth    = 6
+	KRKTestMaxMoves = 25
+)
+
+// With the mating terms driving the lone king to the edge and the kings
+// together, the engine should checkmate with a king and rook against a king,
+// playing both sides, well before the fifty-move rule ends the game in a draw.
+func TestKRKMate(t *testing.T) {
+	var searcher core.Searcher
+	for _, fen := range KRKTestFENs {
+		searcher.Init()
+		searcher.LoadFEN(fen)
+		for ply := 0; ply < 2*KRKTestMaxMoves && !searcher.Board.IsCheckmate(); ply++ {
+			move, _, _ := searcher.SearchToDepth(KRKTestDepth)
+			if move == core.NullMove {
+				break
+			}
+			searcher.Board.DoMove(&move, true)
+		}
+		if !searcher.Board.IsCheckmate() {
+			t.Errorf("expected the engine to mate within %d moves from %v, got %v", KRKTestMaxMoves, fen, searcher.Board.ToFEN())
+		}
+	}
+}
+
+// A position with only the two kings left is a dead draw, so whichever side
+// is to move, the search should score it as the draw the contempt says it is
+// for the engine.
+func TestContempt(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	for _, contempt := range []int{0, 50, -50} {
+		for _, fen := range []string{"8/8/8/8/8/2k5/8/K7 w - - 0 1", "8/8/8/8/8/2k5/8/K7 b - - 0 1"} {
+			searcher.Contempt = contempt
+			searcher.LoadFEN(fen)
+			if _, score, _ := searcher.SearchToDepth(4); score != -contempt {
+				t.Errorf("expected a draw to be scored as %d with a contempt of %d, got %d (%v)",
+					-contempt, contempt, score, fen)
+			}
+		}
+	}
+}
+
+// The knight shuffle the repetition contempt test plays from the starting
+// position, after which white can repeat the position by playing Ng1.
+var RepetitionContemptTestMoves = []string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6"}
+
+// Repeating the position is a draw, so with a contempt low enough, white
+// should prefer it to playing on from an equal position, and with a
+// contempt high enough, it should avoid it.
+func TestRepetitionContempt(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	for _, contempt := range []int{-core.MaxContempt, core.MaxContempt} {
+		searcher.Contempt = contempt
+		searcher.LoadFEN(core.FENStartPosition)
+		for _, moveAsString := range RepetitionContemptTestMoves {
+			move := core.ConvertLongAlgebraicNotationToMove(&searcher.Board, moveAsString)
+			searcher.Board.DoMove(&move, true)
+		}
+
+		move, score, _ := searcher.SearchToDepth(4)
+		repeated := core.ConvertMoveToLongAlgebraicNotation(move) == "f3g1"
+		if contempt < 0 && (!repeated || score != -contempt) {
+			t.Errorf("expected the position to be repeated with a contempt of %d, got %v (%d)",
+				contempt, core.ConvertMoveToLongAlgebraicNotation(move), score)
+		}
+		if contempt > 0 && repeated {
+			t.Errorf("expected the position not to be repeated with a contempt of %d", contempt)
+		}
+	}
+}
+
+// When the side to move has been checkmated or stalemated, the search has no
+// move to return, and should say so by returning a null move. But when every
+// legal move loses, the search should still return one of them.
+func TestGameOverSearch(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+
+	searcher.LoadFEN("7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+	if move, score, _ := searcher.SearchToDepth(4); move != core.NullMove || score != core.NegInf {
+		t.Errorf("expected no move in a checkmated position, got %v (%d)",
+			core.ConvertMoveToLongAlgebraicNotation(move), score)
+	}
+
+	searcher.LoadFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	if move, score, _ := searcher.SearchToDepth(4); move != core.NullMove || score != core.DrawValue {
+		t.Errorf("expected no move in a stalemated position, got %v (%d)",
+			core.ConvertMoveToLongAlgebraicNotation(move), score)
+	}
+
+	// Black's only move is Kb8, after which Rh8 is mate.
+	searcher.LoadFEN("k7/8/1K6/8/8/8/8/7R b - - 0 1")
+	if move, score, _ := searcher.SearchToDepth(4); core.ConvertMoveToLongAlgebraicNotation(move) != "a8b8" ||
+		score != core.NegInf+2 {
+		t.Errorf("expected a8b8 to be played in a lost position, got %v (%d)",
+			core.ConvertMoveToLongAlgebraicNotation(move), score)
+	}
+}
+
+// In this position, white has a mate in six with the queen. The king and
+// queen can reach the same squares by many move orders, so the search finds
+// the mates through the transposition table at different distances from the
+// root, and the mate should still be reported as a mate in six.
+const TTMateTestFEN = "8/8/8/8/8/2k5/8/K2Q4 w - - 0 1"
+
+func TestTTMateScores(t *testing.T) {
+	var searcher core.Searcher
+	searcher.ResizeTT(1)
+	searcher.Init()
+	searcher.LoadFEN(TTMateTestFEN)
+	if _, score, _ := searcher.SearchToDepth(13); score != core.PosInf-11 {
+		t.Errorf("expected a mate in six (%d), got %d", core.PosInf-11, score)
+	}
+}
+
+// The depths searched before and after a pair of moves is played in the
+// transposition table retention test.
+const (
+	TTRetentionFirstDepth  = 8
+	TTRetentionSecondDepth = 6
+)
+
+// Since the transposition table is kept between the moves of a game,
+// searching the position reached after the moves the engine expected should
+// take fewer nodes than searching it with a cleared table. And since a new
+// game clears everything, searching a position right after Init should always
+// take the same number of nodes.
+func TestTTRetention(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	searcher.LoadFEN(core.FENStartPosition)
+	_, _, pv := searcher.SearchToDepth(TTRetentionFirstDepth)
+	if len(pv) < 2 {
+		t.Fatalf("expected a principal variation of at least two moves, got %d", len(pv))
+	}
+	searcher.Board.DoMove(&pv[0], false)
+	searcher.Board.DoMove(&pv[1], false)
+	fen := searcher.Board.ToFEN()
+
+	searcher.SearchToDepth(TTRetentionSecondDepth)
+	retainedNodes := searcher.TotalNodesExplored()
+
+	searcher.Init()
+	searcher.LoadFEN(fen)
+	searcher.SearchToDepth(TTRetentionSecondDepth)
+	clearedNodes := searcher.TotalNodesExplored()
+
+	searcher.Init()
+	searcher.LoadFEN(fen)
+	searcher.SearchToDepth(TTRetentionSecondDepth)
+	if nodes := searcher.TotalNodesExplored(); nodes != clearedNodes {
+		t.Errorf("expected a search after Init to take %d nodes again, got %d", clearedNodes, nodes)
+	}
+	if retainedNodes >= clearedNodes {
+		t.Errorf("expected a search with the table kept to take fewer than %d nodes, got %d", clearedNodes, retainedNodes)
+	}
+}
+
+// The position, depth, and number of threads used to test the node counts.
+const (
+	NodeCountTestFEN     = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	NodeCountTestDepth   = 6
+	NodeCountTestThreads = 2
+)
+
+// The total number of nodes reported for a search should be the sum of the
+// nodes searched by each of its threads, and the nodes searched by the
+// quiescence search should be a part of the main thread's. Searching with a
+// single thread after searching with more shouldn't count the old helpers.
+func TestNodeCounts(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	searcher.LoadFEN(NodeCountTestFEN)
+	searcher.Threads = NodeCountTestThreads
+	searcher.SearchToDepth(NodeCountTestDepth)
+
+	threadNodes := searcher.ThreadNodesExplored()
+	if len(threadNodes) != NodeCountTestThreads {
+		t.Fatalf("expected node counts for %d threads, got %d", NodeCountTestThreads, len(threadNodes))
+	}
+	var sum uint64
+	for thread, nodes := range threadNodes {
+		if nodes == 0 {
+			t.Errorf("expected thread %d to search some nodes", thread)
+		}
+		sum += nodes
+	}
+	if total := searcher.TotalNodesExplored(); total != sum {
+		t.Errorf("expected the total of %d nodes to be the sum of each thread's nodes, %d", total, sum)
+	}
+	if qnodes := searcher.TotalQNodesExplored(); qnodes == 0 || qnodes >= threadNodes[0] {
+		t.Errorf("expected the %d quiescence nodes to be part of the main thread's %d nodes", qnodes, threadNodes[0])
+	}
+
+	searcher.Threads = 1
+	searcher.SearchToDepth(NodeCountTestDepth)
+	threadNodes = searcher.ThreadNodesExplored()
+	if len(threadNodes) != 1 || searcher.TotalNodesExplored() != threadNodes[0] {
+		t.Errorf("expected a single thread to search all %d nodes, got %v", searcher.TotalNodesExplored(), threadNodes)
+	}
+}
+
+// How long the infinite and pondering search tests wait before checking the
+// search is still running, and how long a search gets to give its best move
+// once it's been told to. The search normally stops within a few
+// milliseconds, so the limit is generous, to allow for a busy machine, or
+// the race detector slowing the search down. It only costs time if the test
+// fails.
+const (
+	PonderTestWait  = 300 * time.Millisecond
+	PonderTestLimit = 2 * time.Second
+)
+
+// An infinite search, or one that's pondering, shouldn't give its best move
+// until it's told to stop or the ponder move is played, even when its time
+// limit has run out, or it's finished searching to the depth it was given.
+func TestPonder(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	for _, test := range []struct {
+		Name      string
+		Limits    core.SearchLimits
+		Pondering bool
+		Release   func()
+	}{
+		{"infinite", core.SearchLimits{Infinite: true}, false, searcher.Stop},
+		{"finished infinite", core.SearchLimits{Infinite: true, Depth: 2}, false, searcher.Stop},
+		{"pondering", core.SearchLimits{MoveTime: 50}, true, searcher.PonderHit},
+		{"finished pondering", core.SearchLimits{Depth: 2}, true, searcher.PonderHit},
+		{"stopped pondering", core.SearchLimits{MoveTime: 50}, true, searcher.Stop},
+	} {
+		searcher.LoadFEN(core.FENStartPosition)
+		searcher.ClearStop()
+		searcher.SetPondering(test.Pondering)
+		done := make(chan uint16, 1)
+		go func(limits core.SearchLimits) {
+			move, _, _ := searcher.SearchQuietly(limits)
+			done <- move
+		}(test.Limits)
+
+		select {
+		case <-done:
+			t.Fatalf("%v search gave its best move before it was told to", test.Name)
+		case <-time.After(PonderTestWait):
+		}
+		test.Release()
+		select {
+		case move := <-done:
+			if move == core.NullMove {
+				t.Errorf("%v search gave no best move", test.Name)
+			}
+		case <-time.After(PonderTestLimit):
+			t.Fatalf("%v search didn't give its best move once it was told to", test.Name)
+		}
+	}
+}
+
+// A position with lots of tactics, where each iteration takes much longer
+// than the last, so an iteration started near the end of the time budget
+// would blow through it if it couldn't be abandoned partway through.
+const TimeLimitTestFEN = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+// How much longer than its time limit a search is allowed to take in
+// the time limit tests, in milliseconds, to allow for the time it takes
+// to notice the limit has been reached, and for the machine running the
+// tests being busy.
+const TimeLimitTestSlack = 100
+
+// To ensure the search keeps to its hard time limit, search the test position
+// with a fixed time per move, and with a clock that's nearly run out, and
+// check the search never overruns, and still gives a move from a finished
+// iteration. Since this depends on how fast the search runs, it's skipped in
+// short mode and with the race detector.
+func TestTimeLimits(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("skipping the time limit tests in short mode or with the race detector")
+	}
+	var searcher core.Searcher
+	searcher.Init()
+	for _, test := range []struct {
+		Limits  core.SearchLimits
+		MaxTime int64
+	}{
+		{core.SearchLimits{MoveTime: 100}, 100},
+		{core.SearchLimits{MoveTime: 500}, 500},
+		{core.SearchLimits{TimeLeft: 400, MovesToGo: 1}, 400 - core.MoveOverhead},
+	} {
+		searcher.LoadFEN(TimeLimitTestFEN)
+		start := time.Now()
+		move, _, pv := searcher.SearchQuietly(test.Limits)
+		elapsed := time.Since(start).Milliseconds()
+		if elapsed > test.MaxTime+TimeLimitTestSlack {
+			t.Errorf("expected a search with limits %+v to take at most %dms, took %dms",
+				test.Limits, test.MaxTime, elapsed)
+		}
+		if move == core.NullMove || len(pv) == 0 || pv[0] != move {
+			t.Errorf("expected a search with limits %+v to give a move from a finished iteration", test.Limits)
+		}
+	}
+}
+
+// In this position, white has a mate in five by walking the rooks up the
+// board, one check at a time.
+const MateSearchTestFEN = "8/8/8/8/8/8/3k4/RR4K1 w - - 0 1"
+
+// To ensure "go mate x" searches deep enough to find a mate in x, which
+// can take it past its usual maximum depth, search the test position for a
+// mate in five, which it should find, and for a mate in four, which it
+// shouldn't.
+func TestMateSearch(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+
+	searcher.LoadFEN(MateSearchTestFEN)
+	move, score, _ := searcher.SearchQuietly(core.SearchLimits{MateIn: 5})
+	if move == core.NullMove || score != core.PosInf-9 {
+		t.Errorf("expected a search for a mate in five to find one (%d), got %v (%d)",
+			core.PosInf-9, core.ConvertMoveToLongAlgebraicNotation(move), score)
+	}
+
+	searcher.Init()
+	searcher.LoadFEN(MateSearchTestFEN)
+	move, score, _ = searcher.SearchQuietly(core.SearchLimits{MateIn: 4})
+	if move == core.NullMove || score >= core.PosInf-7 {
+		t.Errorf("expected a search for a mate in four to find none, got %v (%d)",
+			core.ConvertMoveToLongAlgebraicNotation(move), score)
+	}
+}
+
+// In this position, white has a mate in three, which the search should find
+// at every depth from the minimum depth needed to see it up to the maximum.
+const (
+	MateInThreeTestFEN      = "r5rk/5p1p/5R2/4B3/8/8/7P/7K w - - 0 1"
+	MateInThreeTestMinDepth = 5
+	MateInThreeTestMaxDepth = 9
+)
+
+// Since mate scores are measured from the root, rather than from the depth
+// searched to, a mate in three should be scored as one at every depth deep
+// enough to find it, no matter how far the search is extended.
+func TestMateInThree(t *testing.T) {
+	var searcher core.Searcher
+	for depth := MateInThreeTestMinDepth; depth <= MateInThreeTestMaxDepth; depth++ {
+		searcher.Init()
+		searcher.LoadFEN(MateInThreeTestFEN)
+		move, score, _ := searcher.SearchToDepth(depth)
+		if score != core.PosInf-5 {
+			t.Errorf("expected a search to depth %d to find a mate in three (%d), got %v (%d)",
+				depth, core.PosInf-5, core.ConvertMoveToLongAlgebraicNotation(move), score)
+		}
+	}
+}
+
+// The position and depth searched to fill the history table before it's
+// aged.
+const (
+	HistoryAgingTestFEN   = "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+	HistoryAgingTestDepth = 6
+)
+
+// The history table is aged before each search by halving every score in it.
+// A search to a depth of one never fails high at the root, so it can't update
+// the table, and should leave each score at half of what the last search left
+// it at.
+func TestHistoryAging(t *testing.T) {
+	var searcher core.Searcher
+	searcher.Init()
+	searcher.LoadFEN(HistoryAgingTestFEN)
+	searcher.SearchToDepth(HistoryAgingTestDepth)
+
+	var moves []uint16
+	core.GenLegalMoves(&searcher.Board, &moves)
+	scores := make([]int, len(moves))
+	scored := false
+	for index, move := range moves {
+		scores[index] = searcher.HistoryScore(move)
+		scored = scored || scores[index] != 0
+	}
+	if !scored {
+		t.Fatalf("expected the search to give some of the moves a history score")
+	}
+
+	searcher.SearchToDepth(1)
+	for index, move := range moves {
+		if score := searcher.HistoryScore(move); score != scores[index]/2 {
+			t.Errorf("expected the history score of %v to be aged from %d to %d, got %d",
+				core.ConvertMoveToLongAlgebraicNotation(move), scores[index], scores[index]/2, score)
+		}
+	}
+}
+
+// Positions to check the principal variation in, the depth they're searched
+// to, and the number of nodes they're searched for, which runs out partway
+// through an iteration.
+var PVTestFENs = []string{
+	core.FENStartPosition,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"8/2p2k2/3p4/KP5r/1R3p2/8/4P1P1/8 w - - 0 1",
+	"r5rk/5p1p/5R2/4B3/8/8/7P/7K w - - 0 1",
+}
+
+const (
+	PVTestDepth = 6
+	PVTestNodes = 20000
+)
+
+// The principal variation given by a search should always start with the
+// best move it gives, whether the last iteration finished, or was abandoned
+// partway through, so its results were thrown away.
+func TestPVStartsWithBestMove(t *testing.T) {
+	var searcher core.Searcher
+	for _, fen := range PVTestFENs {
+		for _, limits := range []core.SearchLimits{{Depth: PVTestDepth}, {Nodes: PVTestNodes}} {
+			searcher.Init()
+			searcher.LoadFEN(fen)
+			move, _, pv := searcher.SearchQuietly(limits)
+			if move == core.NullMove || len(pv) == 0 || pv[0] != move {
+				t.Errorf("expected the principal variation to start with the best move %v, searching %v with limits %+v",
+					core.ConvertMoveToLongAlgebraicNotation(move), fen, limits)
+			}
+			if limits.Nodes > 0 && searcher.TotalNodesExplored() != limits.Nodes {
+				t.Errorf("expected the search of %v to be stopped partway through an iteration after %d nodes, got %d",
+					fen, limits.Nodes, searcher.TotalNodesExplored())
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"blunder/core"
+	"blunder/tuner"
+	"testing"
+)
+
+// Lines of a file of tuning positions, in each of the formats the tuner
+// accepts, along with the result each should be parsed as.
+var TuningPositionTests = []struct {
+	Line   string
+	Result float64
+}{
+	{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 \"1/2-1/2\";", 0.5},
+	{"4k3/8/8/8/8/8/4P3/3QK3 w - - [1.0]", 1},
+	{"4k3/8/8/8/8/8/8/3qK3 w - - 0 1 0-1", 0},
+	{"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3 0.5", 0.5},
+	{"8/8/4k3/8/8/3RK3/8/8 w - - 0 1 1-0", 1},
+}
+
+// To ensure tuning positions are read correctly, parse a line in each
+// format, and check that lines without a valid result are rejected.
+func TestParseTuningPosition(t *testing.T) {
+	for _, test := range TuningPositionTests {
+		position, err := tuner.ParseTuningPosition(test.Line)
+		if err != nil {
+			t.Fatalf("parsing the tuning position \"%v\" failed: %v", test.Line, err)
+		}
+		if position.Result != test.Result {
+			t.Errorf("parsing the tuning position \"%v\" failed, got result %v", test.Line, position.Result)
+		}
+	}
+
+	for _, line := range []string{core.FENStartPosition, "4k3/8/8/8/8/8/4P3/3QK3 w - - 2-0"} {
+		if _, err := tuner.ParseTuningPosition(line); err == nil {
+			t.Errorf("parsing the tuning position \"%v\" failed: expected an error", line)
+		}
+	}
+}
+
+// The local search only ever keeps changes which lower the error, so tuning
+// should never make the evaluation fit the positions worse. Tuning changes
+// the parameters used by the engine, so they're restored afterwards.
+func TestTuningReducesError(t *testing.T) {
+	defaultParams := core.EvalParameters
+	defer func() { core.EvalParameters = defaultParams }()
+
+	var positions []tuner.TuningPosition
+	for _, test := range TuningPositionTests {
+		position, err := tuner.ParseTuningPosition(test.Line)
+		if err != nil {
+			t.Fatalf("parsing the tuning position \"%v\" failed: %v", test.Line, err)
+		}
+		positions = append(positions, position)
+	}
+
+	k := tuner.FindK(positions)
+	startError := tuner.ComputeError(positions, k)
+	if finalError := tuner.Tune(positions, k, 1); finalError > startError {
+		t.Fatalf("tuning increased the error from %v to %v", startError, finalError)
+	}
+	if tunedError := tuner.ComputeError(positions, k); tunedError > startError {
+		t.Fatalf("the tuned parameters give a larger error than the starting ones: %v and %v", tunedError, startError)
+	}
+}
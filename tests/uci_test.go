@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"blunder/core"
+	inter "blunder/interface"
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The position searched with a panicking helper, which is out of the opening
+// book, and the depth it's searched to.
+const (
+	HelperPanicTestFEN   = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	HelperPanicTestDepth = 6
+)
+
+// Send the given commands to the engine over the UCI protocol, and collect
+// everything it prints until it gives its best move, which is returned.
+func runUCICommands(t *testing.T, commands ...string) (output []string, bestMove string) {
+	stdin, stdout := os.Stdin, os.Stdout
+	inReader, inWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outReader, outWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin, os.Stdout = inReader, outWriter
+	defer func() {
+		os.Stdin, os.Stdout = stdin, stdout
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		inter.RunUCIProtocol()
+		close(done)
+	}()
+	for _, command := range commands {
+		fmt.Fprintln(inWriter, command)
+	}
+
+	scanner := bufio.NewScanner(outReader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		output = append(output, line)
+		if strings.HasPrefix(line, "bestmove") {
+			bestMove = strings.Fields(line)[1]
+			break
+		}
+	}
+	fmt.Fprintln(inWriter, "quit")
+	<-done
+	return output, bestMove
+}
+
+// If one of the helper threads panics, the engine should keep running, and
+// still give a legal best move for the position it was told to search.
+func TestHelperPanic(t *testing.T) {
+	core.HelperSearchHook = func() {
+		panic("forced helper panic")
+	}
+	defer func() {
+		core.HelperSearchHook = nil
+	}()
+
+	output, bestMove := runUCICommands(t,
+		"setoption name OwnBook value false",
+		"setoption name Threads value 2",
+		"position fen "+HelperPanicTestFEN,
+		fmt.Sprintf("go depth %d", HelperPanicTestDepth),
+	)
+	if bestMove == "" {
+		t.Fatalf("expected a best move, got the output %q", output)
+	}
+
+	var board core.Board
+	board.LoadFEN(HelperPanicTestFEN)
+	var moves []uint16
+	core.GenLegalMoves(&board, &moves)
+	for _, move := range moves {
+		if core.ConvertMoveToLongAlgebraicNotation(move) == bestMove {
+			return
+		}
+	}
+	t.Errorf("expected the best move %v to be legal", bestMove)
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"blunder/core"
+	inter "blunder/interface"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// The number of polyglot files of games in testdata/zobrist used to test
+// Zobrist hashing, which are named test1.bin, test2.bin, and so on.
+const ZobristTestFiles = 11
+
+// Read a file at a time from the polyglot files of games in testdata, and
+// test them to verify Zobrist hashing is working correctly (see below).
+func TestZobristHashing(t *testing.T) {
+	var board core.Board
+	for fileNameSuffix := 1; fileNameSuffix <= ZobristTestFiles; fileNameSuffix++ {
+		path := filepath.Join("testdata", "zobrist", fmt.Sprintf("test%d.bin", fileNameSuffix))
+		board.LoadFEN(core.FENStartPosition)
+		testZobristHashing(t, &board, path)
+	}
+}
+
+// To ensure zobrist hashing is working correctly, Blunder's polyglot
+// reader is used to read in a polyglot file from a game played, and
+// apply the moves which correspond to the current board Zobrist hash.
+// If all the moves are applied successivley, then the hashing is working
+// correctly. This is discovered by undoing each move and seeing if the board
+// is returned to its correct beginning state, which is always the inital
+// position.
+func testZobristHashing(t *testing.T, board *core.Board, path string) {
+	entries, err := inter.LoadPolyglotFile(path)
+	if err != nil {
+		t.Fatalf("loading %v failed: %v", path, err)
+	}
+
+	// Play the game out until the file runs out of moves, or the game is
+	// drawn, keeping track of how many times each position has occured
+	// to detect threefold repetition.
+	positionRepeats := make(map[uint64]int)
+	positionRepeats[board.Hash]++
+	var movesMade []uint16
+
+	for !isDrawnGame(board, positionRepeats) {
+		entry, ok := entries[board.Hash]
+		if !ok {
+			break
+		}
+		move := board.DoMoveFromCoords(entry.Move, true, true)
+		movesMade = append(movesMade, move)
+		positionRepeats[board.Hash]++
+	}
+
+	if len(movesMade) == 0 {
+		t.Fatalf("%v: no moves were found for the starting position", path)
+	}
+
+	for len(movesMade) != 0 {
+		move := pop(&movesMade)
+		board.UndoMove(&move)
+		if _, ok := entries[board.Hash]; !ok {
+			t.Fatalf("%v: invalid hash 0x%x after undoing %v, in %v", path, board.Hash, core.MoveToStr(move), board.ToFEN())
+		}
+	}
+
+	if board.Hash != StartingPositionHash {
+		t.Fatalf("%v: undoing every move gave hash 0x%x, expected the starting position's", path, board.Hash)
+	}
+}
+
+// Determine if the game played out by the hashing test is drawn, by
+// threefold repetition, insufficient material, or the fifty-move rule, in
+// which case no more of its moves should be played.
+func isDrawnGame(board *core.Board, positionRepeats map[uint64]int) bool {
+	return positionRepeats[board.Hash] >= 3 || board.IsInsufficientMaterial() ||
+		board.HalfMoveClock >= core.FiftyMoveRuleLimit
+}
+
+// To ensure the hashing test stops playing once its game is drawn, check
+// draws by insufficient material and the fifty-move rule are recognized,
+// along with a position that isn't drawn, and a position that has occured
+// three times.
+func TestDrawnGameDetection(t *testing.T) {
+	var board core.Board
+	for _, test := range []struct {
+		FEN     string
+		IsDrawn bool
+	}{
+		{core.FENStartPosition, false},
+		{"8/8/4k3/8/8/3NK3/8/8 w - - 0 1", true},
+		{"8/8/4k3/8/8/3RK3/8/8 w - - 99 80", false},
+		{"8/8/4k3/8/8/3RK3/8/8 w - - 100 80", true},
+	} {
+		board.LoadFEN(test.FEN)
+		if isDrawn := isDrawnGame(&board, map[uint64]int{}); isDrawn != test.IsDrawn {
+			t.Errorf("detecting a draw in %v failed, got %v", test.FEN, isDrawn)
+		}
+	}
+
+	board.LoadFEN(core.FENStartPosition)
+	if !isDrawnGame(&board, map[uint64]int{board.Hash: 3}) {
+		t.Errorf("detecting a draw by threefold repetition failed")
+	}
+}
+
+// A helper function to pop and item from a slice
+func pop(s *[]uint16) (item uint16) {
+	item, *s = (*s)[len(*s)-1], (*s)[:len(*s)-1]
+	return item
+}
+
+// Positions to test null moves in, including one with an en passant square
+// that's part of the hash, since a null move has to clear it.
+var NullMoveTestFENs = []string{
+	core.FENStartPosition,
+	"rnbqkbnr/ppppp1pp/8/4Pp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 0 1",
+}
+
+// To ensure null moves keep the Zobrist hash consistent, make a null move in
+// each test position and check the hash matches the one computed from scratch
+// for the resulting position, and then undo it and check the position and its
+// hash are exactly what they were before.
+func TestNullMoveHashing(t *testing.T) {
+	var board core.Board
+	for _, fen := range NullMoveTestFENs {
+		board.LoadFEN(fen)
+		hash := board.Hash
+
+		board.MakeNullMove()
+		if err := board.Verify(); err != nil {
+			t.Fatalf("making a null move in %v failed: %v", fen, err)
+		}
+		if board.Hash == hash || board.EPSquare != core.NoEPSquare {
+			t.Fatalf("making a null move in %v didn't pass the turn, got %v", fen, board.ToFEN())
+		}
+
+		board.UndoNullMove()
+		if board.Hash != hash || board.ToFEN() != fen {
+			t.Fatalf("undoing a null move in %v failed, got %v (hash 0x%x, expected 0x%x)",
+				fen, board.ToFEN(), board.Hash, hash)
+		}
+	}
+}
+
+// Positions to walk the move tree of when testing that making and unmaking
+// moves keeps the Zobrist hash consistent, most of them chosen for their en
+// passant captures and double pawn pushes.
+var MakeUnmakeHashingTestFENs = []string{
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	"8/8/8/2k5/2pP4/8/B7/4K3 b - d3 0 3",
+}
+
+// The depth the move trees of the positions above are walked to.
+const MakeUnmakeHashingTestDepth = 3
+
+// To ensure making and unmaking moves never lets the incrementally updated
+// Zobrist hash drift, walk the move tree of each test position, and check the
+// hash against one computed from scratch after every move is made, and that
+// it's exactly what it was before once the move is unmade.
+func TestMakeUnmakeHashing(t *testing.T) {
+	var board core.Board
+	for _, fen := range MakeUnmakeHashingTestFENs {
+		board.LoadFEN(fen)
+		walkMakeUnmakeHashingTree(t, &board, MakeUnmakeHashingTestDepth)
+	}
+}
+
+func walkMakeUnmakeHashingTree(t *testing.T, board *core.Board, depth int) {
+	if depth == 0 {
+		return
+	}
+	var moves []uint16
+	core.GenLegalMoves(board, &moves)
+	for _, move := range moves {
+		hash, fen := board.Hash, board.ToFEN()
+		board.DoMove(&move, true)
+		if err := board.Verify(); err != nil {
+			t.Fatalf("making %v in %v failed: %v", core.MoveToStr(move), fen, err)
+		}
+		walkMakeUnmakeHashingTree(t, board, depth-1)
+		board.UndoMove(&move)
+		if board.Hash != hash {
+			t.Fatalf("unmaking %v in %v failed: hash is 0x%x, but should be 0x%x",
+				core.MoveToStr(move), fen, board.Hash, hash)
+		}
+	}
+}
+
+// Positions where every corner rook can be captured, by a rook from the
+// opposite corner, so it loses its own castling right in the same move,
+// or by a knight.
+var CornerRookCaptureTestFENs = []string{
+	"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+	"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+	"r3k2r/8/1N4N1/8/8/1n4n1/8/R3K2R w KQkq - 0 1",
+	"r3k2r/8/1N4N1/8/8/1n4n1/8/R3K2R b KQkq - 0 1",
+}
+
+// To ensure losing a castling right is hashed exactly once, however the
+// rook is lost, capture each corner rook in the test positions and check
+// the hash against one computed from scratch. Then walk the move tree of
+// each position, where rooks are captured and other rooks move in the same
+// lines.
+func TestCornerRookCaptureHashing(t *testing.T) {
+	var board core.Board
+	for _, fen := range CornerRookCaptureTestFENs {
+		board.LoadFEN(fen)
+		var moves []uint16
+		core.GenLegalMoves(&board, &moves)
+		for _, move := range moves {
+			_, to, _ := core.GetMoveInfo(move)
+			if pieceType, _, occupied := board.PieceAt(to); !occupied || pieceType != core.RookBB {
+				continue
+			}
+			board.DoMove(&move, true)
+			if err := board.Verify(); err != nil {
+				t.Fatalf("capturing a corner rook with %v in %v failed: %v", core.MoveToStr(move), fen, err)
+			}
+			board.UndoMove(&move)
+		}
+		walkMakeUnmakeHashingTree(t, &board, MakeUnmakeHashingTestDepth)
+	}
+}
@@ -0,0 +1,317 @@
+package tuner
+
+import (
+	"blunder/core"
+	"bufio"
+	"fmt"
+	"go/format"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/* This file contains a tuner for the evaluation parameters (see EvalParams
+in core/evaluate.go), using the method known as Texel tuning. The tuner is
+given a set of quiet positions, each labeled with the result of the game it
+was taken from, and the static evaluation of each position is mapped through
+a sigmoid to the result it predicts. The error of the evaluation is the mean
+squared difference between the predicted and actual results, and the tuner
+searches for the parameters which make it as small as possible.
+
+The search is a simple local search: each parameter in turn is nudged up,
+and then down, and the change is kept if it lowers the error. This is
+repeated over all of the parameters until none of them can be improved, or
+the given number of iterations is up.
+*/
+
+const (
+	// The amount each parameter is nudged by at each step of the local
+	// search, in centipawns.
+	TuningStep = 1
+
+	// The maximum number of times the local search goes over every
+	// parameter, if no other number is given.
+	DefaultIterations = 100
+)
+
+// A position to tune the evaluation with, along with the result of the game
+// it was taken from, from white's point of view: 1 for a win for white, 0.5
+// for a draw, and 0 for a win for black.
+type TuningPosition struct {
+	Board  core.Board
+	Result float64
+}
+
+// Parse a line of a file of tuning positions. A line is a FEN string (both
+// clocks can be left off), followed by the result of the game, given as
+// 1-0, 0-1, or 1/2-1/2, or as 1, 0.5, or 0, and optionally in brackets or
+// quotes. The result can also be given by the c9 opcode of an EPD line, as
+// in `... w - - c9 "1-0";`.
+func ParseTuningPosition(line string) (TuningPosition, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return TuningPosition{}, fmt.Errorf("invalid tuning position \"%v\": expected a fen string and a result", line)
+	}
+
+	var position TuningPosition
+	switch strings.Trim(fields[len(fields)-1], "[]\";") {
+	case "1-0", "1", "1.0":
+		position.Result = 1
+	case "1/2-1/2", "0.5":
+		position.Result = 0.5
+	case "0-1", "0", "0.0":
+		position.Result = 0
+	default:
+		return TuningPosition{}, fmt.Errorf("invalid tuning position \"%v\": unknown result %v", line, fields[len(fields)-1])
+	}
+
+	// The FEN string has to have both of its clocks, or neither of them,
+	// so the full move number of a FEN string with no result can't be
+	// mistaken for a result.
+	fenFields := fields[:len(fields)-1]
+	if fenFields[len(fenFields)-1] == "c9" {
+		fenFields = fenFields[:len(fenFields)-1]
+	}
+	if len(fenFields) != 4 && len(fenFields) != 6 {
+		return TuningPosition{}, fmt.Errorf("invalid tuning position \"%v\": expected a fen string and a result", line)
+	}
+	if err := position.Board.LoadFEN(strings.Join(fenFields, " ")); err != nil {
+		return TuningPosition{}, fmt.Errorf("invalid tuning position \"%v\": %v", line, err)
+	}
+	return position, nil
+}
+
+// Load the tuning positions in the given file, one position to each line.
+// Blank lines are skipped.
+func LoadTuningPositions(path string) ([]TuningPosition, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var positions []TuningPosition
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		position, err := ParseTuningPosition(line)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	return positions, scanner.Err()
+}
+
+// Map an evaluation, from white's point of view, to the result of the game
+// it predicts, from 0 to 1. The scaling constant k depends on the scale of
+// the evaluation, and is found by FindK.
+func sigmoid(score, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+// Compute the mean squared error of the current evaluation parameters over
+// the tuning positions, using the scaling constant k. The positions are
+// split between a goroutine for each CPU, and each board's material and
+// piece square table scores are recomputed first, since the parameters
+// they're computed from may have changed.
+func ComputeError(positions []TuningPosition, k float64) float64 {
+	if len(positions) == 0 {
+		return 0
+	}
+
+	workers := runtime.NumCPU()
+	chunkSize := (len(positions) + workers - 1) / workers
+	errors := make([]float64, workers)
+
+	var group sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		start, end := worker*chunkSize, (worker+1)*chunkSize
+		if end > len(positions) {
+			end = len(positions)
+		}
+		if start >= end {
+			break
+		}
+
+		group.Add(1)
+		go func(worker, start, end int) {
+			defer group.Done()
+			for index := start; index < end; index++ {
+				position := &positions[index]
+				position.Board.RefreshEvalScores()
+				score := core.Evaluate(&position.Board)
+				if !position.Board.WhiteToMove {
+					score = -score
+				}
+				difference := position.Result - sigmoid(float64(score), k)
+				errors[worker] += difference * difference
+			}
+		}(worker, start, end)
+	}
+	group.Wait()
+
+	totalError := 0.0
+	for _, workerError := range errors {
+		totalError += workerError
+	}
+	return totalError / float64(len(positions))
+}
+
+// Find the scaling constant for the sigmoid which gives the smallest error
+// for the current evaluation parameters, to two decimal places.
+func FindK(positions []TuningPosition) float64 {
+	k, bestError := 1.0, ComputeError(positions, 1.0)
+	for _, step := range []float64{0.1, 0.01} {
+		for _, direction := range []float64{1, -1} {
+			for {
+				newError := ComputeError(positions, k+step*direction)
+				if newError >= bestError {
+					break
+				}
+				k, bestError = k+step*direction, newError
+			}
+		}
+	}
+	return k
+}
+
+// Get pointers to every tunable parameter of the evaluation, which is every
+// integer in the given parameters, including each entry of their tables.
+func tunableParams(params *core.EvalParams) (tunable []*int) {
+	var collect func(value reflect.Value)
+	collect = func(value reflect.Value) {
+		switch value.Kind() {
+		case reflect.Int:
+			tunable = append(tunable, value.Addr().Interface().(*int))
+		case reflect.Array:
+			for index := 0; index < value.Len(); index++ {
+				collect(value.Index(index))
+			}
+		}
+	}
+
+	paramsValue := reflect.ValueOf(params).Elem()
+	for field := 0; field < paramsValue.NumField(); field++ {
+		collect(paramsValue.Field(field))
+	}
+	return tunable
+}
+
+// Tune the evaluation parameters used by the engine over the tuning
+// positions, using the scaling constant k, and going over every parameter
+// at most the given number of times. The error after each iteration is
+// printed, and the smallest error found is returned. The tuned parameters
+// are left in core.EvalParameters.
+func Tune(positions []TuningPosition, k float64, iterations int) float64 {
+	params := tunableParams(&core.EvalParameters)
+	bestError := ComputeError(positions, k)
+
+	for iteration := 1; iteration <= iterations; iteration++ {
+		improved := false
+		for _, param := range params {
+			*param += TuningStep
+			if newError := ComputeError(positions, k); newError < bestError {
+				bestError, improved = newError, true
+				continue
+			}
+
+			*param -= 2 * TuningStep
+			if newError := ComputeError(positions, k); newError < bestError {
+				bestError, improved = newError, true
+				continue
+			}
+			*param += TuningStep
+		}
+
+		fmt.Printf("iteration %d: error %.8f\n", iteration, bestError)
+		if !improved {
+			break
+		}
+	}
+	return bestError
+}
+
+// Format evaluation parameters as the Go declaration of EvalParameters in
+// core/evaluate.go, so the tuned parameters can be pasted in place of the
+// current ones.
+func FormatParams(params core.EvalParams) string {
+	var source strings.Builder
+	source.WriteString("var EvalParameters EvalParams = EvalParams{\n")
+	paramsValue := reflect.ValueOf(params)
+	for field := 0; field < paramsValue.NumField(); field++ {
+		value := paramsValue.Field(field)
+		typeName := ""
+		if value.Kind() == reflect.Array {
+			typeName = value.Type().String()
+		}
+		fmt.Fprintf(&source, "\t%v: %v%v,\n", paramsValue.Type().Field(field).Name, typeName, formatValue(value, "\t"))
+	}
+	source.WriteString("}\n")
+
+	formatted, err := format.Source([]byte(source.String()))
+	if err != nil {
+		return source.String()
+	}
+	return string(formatted)
+}
+
+// Format a single parameter, or a table of them, as a Go literal. Tables
+// of tables are written one table to a line, and long rows, such as the
+// rows of the piece square tables, are written eight entries to a line.
+func formatValue(value reflect.Value, indent string) string {
+	switch value.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int:
+		return strconv.Itoa(int(value.Int()))
+	case reflect.Array:
+		var entries []string
+		for index := 0; index < value.Len(); index++ {
+			entries = append(entries, formatValue(value.Index(index), indent+"\t"))
+		}
+
+		if value.Type().Elem().Kind() == reflect.Array {
+			return "{\n" + indent + "\t" + strings.Join(entries, ",\n"+indent+"\t") + ",\n" + indent + "}"
+		}
+		if len(entries) <= 16 {
+			return "{" + strings.Join(entries, ", ") + "}"
+		}
+		var lines []string
+		for start := 0; start < len(entries); start += 8 {
+			end := start + 8
+			if end > len(entries) {
+				end = len(entries)
+			}
+			lines = append(lines, strings.Join(entries[start:end], ", "))
+		}
+		return "{\n" + indent + "\t" + strings.Join(lines, ",\n"+indent+"\t") + ",\n" + indent + "}"
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// Tune the evaluation parameters on the tuning positions in the given file,
+// going over every parameter at most the given number of times, and print
+// the tuned parameters once done.
+func Run(path string, iterations int) error {
+	positions, err := LoadTuningPositions(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d positions\n", len(positions))
+
+	k := FindK(positions)
+	fmt.Printf("Using k = %.2f, starting error %.8f\n", k, ComputeError(positions, k))
+
+	finalError := Tune(positions, k, iterations)
+	fmt.Printf("Final error %.8f, with the tuned parameters:\n\n", finalError)
+	fmt.Print(FormatParams(core.EvalParameters))
+	return nil
+}